@@ -12,6 +12,7 @@ import (
 
 func main() {
 	Run()
+	Count()
 }
 
 func Run() ([]byte, error) {
@@ -26,3 +27,17 @@ func Run() ([]byte, error) {
 	})
 	return nil, nil
 }
+
+func Count() (int, error) {
+	Try(func() {
+		file, _ := os.Open("hello.txt")
+		defer file.Close()
+		content, _ := io.ReadAll(file)
+		Return(len(content))
+	}).Catch(Error(os.ErrNotExist), func(err error) {
+		fmt.Println("file not found:", err)
+	}).Finally(func() {
+		fmt.Println("count finished")
+	})
+	return 0, nil
+}
@@ -3,68 +3,182 @@
 package main
 
 import (
+	errors_JA9DS5M0SK "errors"
 	"fmt"
 	"io"
 	"os"
-
-	errors_JA9DS5M0SK "errors"
 )
 
+//line main.go:13
 func main() {
 	Run()
+	Count()
 }
 
 func Run() ([]byte, error) {
 	{
-		var resultUPH82AR1SS []byte
-		var catchErr4K9AHBGELS error
-		var hasRet5PRN3G50I8 bool
+//line main.go:19
+		var resultMMFH4NGSM0 []byte
+//line main.go:19
+		var catchErrGEMP8C01I4 error
+//line main.go:19
+		var hasRet4U5B889IR4 bool
+//line main.go:19
 		{
-
-			file, errVJ948GMHAK := os.Open("hello.txt")
-			if errVJ948GMHAK != nil {
-				catchErr4K9AHBGELS = errVJ948GMHAK
-				goto CatchTBC0MLSJ4S
+			file, errO4S6T449GC := os.Open("hello.txt")
+//line main.go:20
+			if errO4S6T449GC != nil {
+//line main.go:20
+				catchErrGEMP8C01I4 = errO4S6T449GC
+//line main.go:20
+				goto CatchCE20UI4RB8
+//line main.go:20
 			}
-
 			defer file.Close()
+			content, errAHDR58EIPC := io.ReadAll(file)
+//line main.go:22
+			if errAHDR58EIPC != nil {
+//line main.go:22
+				catchErrGEMP8C01I4 = errAHDR58EIPC
+//line main.go:22
+				goto CatchCE20UI4RB8
+//line main.go:22
+			}
+			resultMMFH4NGSM0 = content
+//line main.go:23
+			hasRet4U5B889IR4 = true
+//line main.go:23
+			goto FinallyPG721KB6LO
+//line main.go:19
+		}
+//line main.go:19
+	CatchCE20UI4RB8:
+//line main.go:19
+		{
+//line main.go:19
+			if errors_JA9DS5M0SK.As(catchErrGEMP8C01I4, new(*os.PathError)) {
+//line main.go:19
+				err := catchErrGEMP8C01I4
+//line main.go:19
+				catchErrGEMP8C01I4 = nil
 
-			content, errL0OS45QF7O := io.ReadAll(file)
-			if errL0OS45QF7O != nil {
-				catchErr4K9AHBGELS = errL0OS45QF7O
-				goto CatchTBC0MLSJ4S
+//line main.go:25
+				_, err7AEKQS8160 := fmt.Println("error occured:", err)
+//line main.go:25
+				if err7AEKQS8160 != nil {
+//line main.go:25
+					catchErrGEMP8C01I4 = err7AEKQS8160
+//line main.go:25
+					goto FinallyPG721KB6LO
+//line main.go:25
+				}
+				catchErrGEMP8C01I4 = err
+//line main.go:19
+				goto FinallyPG721KB6LO
+//line main.go:19
+			}
+//line main.go:19
+		}
+//line main.go:19
+	FinallyPG721KB6LO:
+//line main.go:19
+		{
+//line main.go:19
+			if hasRet4U5B889IR4 || catchErrGEMP8C01I4 != nil {
+//line main.go:19
+				return resultMMFH4NGSM0, catchErrGEMP8C01I4
+//line main.go:19
 			}
+//line main.go:19
+		}
+//line main.go:19
+	}
 
-			resultUPH82AR1SS = content
-			hasRet5PRN3G50I8 = true
-			goto Finally8KDIGIEIBS
+//line main.go:28
+	return nil, nil
+}
 
-			goto Finally8KDIGIEIBS
+func Count() (int, error) {
+	{
+//line main.go:32
+		var resultMTIGDUM2U8 int
+//line main.go:32
+		var catchErr61UR2RAEFC error
+//line main.go:32
+		var hasRetBU3PO6OUMG bool
+//line main.go:32
+		{
+			file, errGLBC8DN7G0 := os.Open("hello.txt")
+//line main.go:33
+			if errGLBC8DN7G0 != nil {
+//line main.go:33
+				catchErr61UR2RAEFC = errGLBC8DN7G0
+//line main.go:33
+				goto CatchOFBO63M1DO
+//line main.go:33
+			}
+			defer file.Close()
+			content, errB4780C99UO := io.ReadAll(file)
+//line main.go:35
+			if errB4780C99UO != nil {
+//line main.go:35
+				catchErr61UR2RAEFC = errB4780C99UO
+//line main.go:35
+				goto CatchOFBO63M1DO
+//line main.go:35
+			}
+			resultMTIGDUM2U8 = len(content)
+//line main.go:36
+			hasRetBU3PO6OUMG = true
+//line main.go:36
+			goto FinallyUF0CTJ85RC
+//line main.go:32
 		}
-	CatchTBC0MLSJ4S:
+//line main.go:32
+	CatchOFBO63M1DO:
+//line main.go:32
 		{
-			if errors_JA9DS5M0SK.As(catchErr4K9AHBGELS, *os.PathError) {
-				err := catchErr4K9AHBGELS
-				catchErr4K9AHBGELS = nil
+//line main.go:32
+			if errors_JA9DS5M0SK.Is(catchErr61UR2RAEFC, os.ErrNotExist) {
+//line main.go:32
+				err := catchErr61UR2RAEFC
+//line main.go:32
+				catchErr61UR2RAEFC = nil
 
-				_, errRMSCQGU0GS := fmt.Println("error occured:", err)
-				if errRMSCQGU0GS != nil {
-					catchErr4K9AHBGELS = errRMSCQGU0GS
-					goto Finally8KDIGIEIBS
+//line main.go:38
+				_, errAVPPSPOA5K := fmt.Println("file not found:", err)
+//line main.go:38
+				if errAVPPSPOA5K != nil {
+//line main.go:38
+					catchErr61UR2RAEFC = errAVPPSPOA5K
+//line main.go:38
+					goto FinallyUF0CTJ85RC
+//line main.go:38
 				}
-
-				catchErr4K9AHBGELS = err
-				goto Finally8KDIGIEIBS
-
-				goto Finally8KDIGIEIBS
+//line main.go:32
+				goto FinallyUF0CTJ85RC
+//line main.go:32
 			}
+//line main.go:32
 		}
-	Finally8KDIGIEIBS:
+//line main.go:32
+	FinallyUF0CTJ85RC:
+//line main.go:32
 		{
-			if hasRet5PRN3G50I8 || catchErr4K9AHBGELS != nil {
-				return resultUPH82AR1SS, catchErr4K9AHBGELS
+
+//line main.go:40
+			fmt.Println("count finished")
+//line main.go:32
+			if hasRetBU3PO6OUMG || catchErr61UR2RAEFC != nil {
+//line main.go:32
+				return resultMTIGDUM2U8, catchErr61UR2RAEFC
+//line main.go:32
 			}
+//line main.go:32
 		}
+//line main.go:32
 	}
-	return nil, nil
+
+//line main.go:42
+	return 0, nil
 }
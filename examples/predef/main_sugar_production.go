@@ -4,6 +4,7 @@ package main
 
 import "fmt"
 
+//line main.go:11
 func main() {
 	TestIdentifier()
 }
@@ -7,13 +7,14 @@ import (
 	"io"
 	"os"
 
-	. "github.com/arcane-craft/sugar/option"
+	"github.com/arcane-craft/sugar/option"
 	. "github.com/arcane-craft/sugar/result"
 )
 
 func main() {
 	ResultQuestion()
 	OptionQuestion()
+	CommaQuestion()
 }
 
 func ResultQuestion() Result[string] {
@@ -27,32 +28,37 @@ type JSONValue struct {
 	any
 }
 
-func (v JSONValue) String() Option[string] {
+func (v JSONValue) String() option.Option[string] {
 	s, ok := v.any.(string)
 	if !ok {
-		return None[string]()
+		return option.None[string]()
 	}
-	return Some(s)
+	return option.Some(s)
 }
 
 type JSONObject map[string]any
 
-func Deocde(content []byte) Option[JSONObject] {
+func Deocde(content []byte) option.Option[JSONObject] {
 	var obj JSONObject
 	if err := json.Unmarshal(content, &obj); err != nil {
-		return None[JSONObject]()
+		return option.None[JSONObject]()
 	}
-	return Some(obj)
+	return option.Some(obj)
 }
 
-func (o JSONObject) Get(key string) Option[JSONValue] {
+func (o JSONObject) Get(key string) option.Option[JSONValue] {
 	value, ok := o[key]
 	if !ok {
-		return None[JSONValue]()
+		return option.None[JSONValue]()
 	}
-	return Some(JSONValue{value})
+	return option.Some(JSONValue{value})
 }
 
-func OptionQuestion() Option[string] {
+func OptionQuestion() option.Option[string] {
 	return Deocde([]byte(`{"hello":"world"}`)).Q().Get("hello").Q().String()
 }
+
+func CommaQuestion() option.Option[string] {
+	home := option.FromComma(os.LookupEnv("HOME")).Q()
+	return option.Some(home)
+}
@@ -7,30 +7,37 @@ import (
 	"io"
 	"os"
 
-	. "github.com/arcane-craft/sugar/option"
-
+	"github.com/arcane-craft/sugar/option"
 	. "github.com/arcane-craft/sugar/result"
 )
 
+//line main.go:14
 func main() {
 	ResultQuestion()
 	OptionQuestion()
+	CommaQuestion()
 }
 
 func ResultQuestion() Result[string] {
-	var07QIGRQF8K := From(os.Open("hello.txt"))
-	if var07QIGRQF8K.IsErr() {
-		return Err[string](var07QIGRQF8K.UnwrapErr())
+	varN2FBM21TIK, errKB8J3I5NM4 := os.Open("hello.txt")
+//line main.go:21
+	if errKB8J3I5NM4 != nil {
+//line main.go:21
+		return Err[string](errKB8J3I5NM4)
+//line main.go:21
 	}
-	file := var07QIGRQF8K.Unwrap()
-
+//line main.go:21
+	file := varN2FBM21TIK
 	defer file.Close()
-	var60KDCIE178 := From(io.ReadAll(file))
-	if var60KDCIE178.IsErr() {
-		return Err[string](var60KDCIE178.UnwrapErr())
+	varJEO0APFCJ8, errJHRBJL3AA4 := io.ReadAll(file)
+//line main.go:23
+	if errJHRBJL3AA4 != nil {
+//line main.go:23
+		return Err[string](errJHRBJL3AA4)
+//line main.go:23
 	}
-	content := var60KDCIE178.Unwrap()
-
+//line main.go:23
+	content := varJEO0APFCJ8
 	return Ok(string(content))
 }
 
@@ -38,40 +45,61 @@ type JSONValue struct {
 	any
 }
 
-func (v JSONValue) String() Option[string] {
+func (v JSONValue) String() option.Option[string] {
 	s, ok := v.any.(string)
 	if !ok {
-		return None[string]()
+		return option.None[string]()
 	}
-	return Some(s)
+	return option.Some(s)
 }
 
 type JSONObject map[string]any
 
-func Deocde(content []byte) Option[JSONObject] {
+func Deocde(content []byte) option.Option[JSONObject] {
 	var obj JSONObject
 	if err := json.Unmarshal(content, &obj); err != nil {
-		return None[JSONObject]()
+		return option.None[JSONObject]()
 	}
-	return Some(obj)
+	return option.Some(obj)
 }
 
-func (o JSONObject) Get(key string) Option[JSONValue] {
+func (o JSONObject) Get(key string) option.Option[JSONValue] {
 	value, ok := o[key]
 	if !ok {
-		return None[JSONValue]()
+		return option.None[JSONValue]()
 	}
-	return Some(JSONValue{value})
+	return option.Some(JSONValue{value})
 }
 
-func OptionQuestion() Option[string] {
-	varGRIG5FKNGC := Deocde([]byte(`{"hello":"world"}`))
-	if varGRIG5FKNGC.IsNone() {
-		return None[string]()
+func OptionQuestion() option.Option[string] {
+	varI9KN8V6I6G := Deocde([]byte(`{"hello":"world"}`))
+//line main.go:58
+	if varI9KN8V6I6G.IsNone() {
+//line main.go:58
+		return option.None[string]()
+//line main.go:58
 	}
-	var4OEKS2K7VS := varGRIG5FKNGC.Unwrap().Get("hello")
-	if var4OEKS2K7VS.IsNone() {
-		return None[string]()
+//line main.go:58
+	varFVAK5E72E8 := varI9KN8V6I6G.Unwrap().Get("hello")
+//line main.go:58
+	if varFVAK5E72E8.IsNone() {
+//line main.go:58
+		return option.None[string]()
+//line main.go:58
+	}
+//line main.go:58
+	return varFVAK5E72E8.Unwrap().String()
+}
+
+func CommaQuestion() option.Option[string] {
+	varTG8LJ7D2AC, okIT47U577E4 := os.LookupEnv("HOME")
+//line main.go:62
+	if !okIT47U577E4 {
+//line main.go:62
+		return option.None[string]()
+//line main.go:62
 	}
-	return var4OEKS2K7VS.Unwrap().String()
+//line main.go:62
+	home := varTG8LJ7D2AC
+	return option.Some(home)
 }
@@ -35,3 +35,13 @@ func TryWithDefer() (c []byte, e error) {
 	content := Try(io.ReadAll(file))
 	return content, nil
 }
+
+// the errors returned by TryWrapped are prefixed with its signature
+//
+//sugar:try-wrap func
+func TryWrapped() ([]byte, error) {
+	file := Try(os.Open("hello.txt"))
+	defer file.Close()
+	content := Try(io.ReadAll(file))
+	return content, nil
+}
@@ -9,21 +9,30 @@ import (
 	"os"
 )
 
+//line main.go:14
 func main() {
 	TryOnly()
 }
 
-func TryOnly() (_ []byte, err9EIH73OK48 error) {
-	file, errCEGNQ31MMK := os.Open("hello.txt")
-	if errCEGNQ31MMK != nil {
-		err9EIH73OK48 = errCEGNQ31MMK
+func TryOnly() (_ []byte, err8KKA2BI8KK error) {
+	file, err74748PTR3G := os.Open("hello.txt")
+//line main.go:19
+	if err74748PTR3G != nil {
+//line main.go:19
+		err8KKA2BI8KK = err74748PTR3G
+//line main.go:19
 		return
+//line main.go:19
 	}
 	defer file.Close()
-	content, errT07OPFVK5O := io.ReadAll(file)
-	if errT07OPFVK5O != nil {
-		err9EIH73OK48 = errT07OPFVK5O
+	content, err1J6HNBTHAK := io.ReadAll(file)
+//line main.go:21
+	if err1J6HNBTHAK != nil {
+//line main.go:21
+		err8KKA2BI8KK = err1J6HNBTHAK
+//line main.go:21
 		return
+//line main.go:21
 	}
 	return content, nil
 }
@@ -36,16 +45,60 @@ func TryWithDefer() (c []byte, e error) {
 		}
 	}()
 
-	file, errFENAO9VRCC := os.Open("hello.txt")
-	if errFENAO9VRCC != nil {
-		e = errFENAO9VRCC
+	file, errD5J4L4IN7S := os.Open("hello.txt")
+//line main.go:33
+	if errD5J4L4IN7S != nil {
+//line main.go:33
+		e = errD5J4L4IN7S
+//line main.go:33
 		return
+//line main.go:33
 	}
 	defer file.Close()
-	content, err8T86277SQK := io.ReadAll(file)
-	if err8T86277SQK != nil {
-		e = err8T86277SQK
+	content, errCQBKOVEV9G := io.ReadAll(file)
+//line main.go:35
+	if errCQBKOVEV9G != nil {
+//line main.go:35
+		e = errCQBKOVEV9G
+//line main.go:35
 		return
+//line main.go:35
+	}
+	return content, nil
+}
+
+// the errors returned by TryWrapped are prefixed with its signature
+//
+//sugar:try-wrap func
+func TryWrapped() (_ []byte, errVGIQLOO1CC error) {
+	defer func() {
+//line main.go:43
+		if errVGIQLOO1CC != nil {
+//line main.go:43
+			errVGIQLOO1CC = fmt.Errorf("func TryWrapped() ([]byte, error): %w", errVGIQLOO1CC)
+//line main.go:43
+		}
+//line main.go:43
+	}()
+//line main.go:43
+	file, errNV2S8QU9PS := os.Open("hello.txt")
+//line main.go:43
+	if errNV2S8QU9PS != nil {
+//line main.go:43
+		errVGIQLOO1CC = errNV2S8QU9PS
+//line main.go:43
+		return
+//line main.go:43
+	}
+	defer file.Close()
+	content, err3BGQ25B0D8 := io.ReadAll(file)
+//line main.go:45
+	if err3BGQ25B0D8 != nil {
+//line main.go:45
+		errVGIQLOO1CC = err3BGQ25B0D8
+//line main.go:45
+		return
+//line main.go:45
 	}
 	return content, nil
 }
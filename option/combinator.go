@@ -0,0 +1,127 @@
+package option
+
+import (
+	"github.com/arcane-craft/sugar/tuple"
+)
+
+func Map[T, U any](o Option[T], f func(T) U) Option[U] {
+	if o.IsNone() {
+		return None[U]()
+	}
+	return Some(f(o.Unwrap()))
+}
+
+func MapOr[T, U any](o Option[T], def U, f func(T) U) U {
+	if o.IsNone() {
+		return def
+	}
+	return f(o.Unwrap())
+}
+
+func MapOrElse[T, U any](o Option[T], def func() U, f func(T) U) U {
+	if o.IsNone() {
+		return def()
+	}
+	return f(o.Unwrap())
+}
+
+func AndThen[T, U any](o Option[T], f func(T) Option[U]) Option[U] {
+	if o.IsNone() {
+		return None[U]()
+	}
+	return f(o.Unwrap())
+}
+
+func And[T, U any](o Option[T], opt Option[U]) Option[U] {
+	if o.IsNone() {
+		return None[U]()
+	}
+	return opt
+}
+
+func Filter[T any](o Option[T], predicate func(T) bool) Option[T] {
+	if o.IsSome() && predicate(o.Unwrap()) {
+		return o
+	}
+	return None[T]()
+}
+
+func Or[T any](o Option[T], opt Option[T]) Option[T] {
+	if o.IsNone() {
+		return opt
+	}
+	return o
+}
+
+func OrElse[T any](o Option[T], f func() Option[T]) Option[T] {
+	if o.IsNone() {
+		return f()
+	}
+	return o
+}
+
+func Xor[T any](o Option[T], opt Option[T]) Option[T] {
+	if o.IsSome() && opt.IsNone() {
+		return o
+	}
+	if o.IsNone() && opt.IsSome() {
+		return opt
+	}
+	return None[T]()
+}
+
+func Zip[A, B any](a Option[A], b Option[B]) Option[tuple.Pair[A, B]] {
+	if a.IsNone() || b.IsNone() {
+		return None[tuple.Pair[A, B]]()
+	}
+	return Some(tuple.NewPair(a.Unwrap(), b.Unwrap()))
+}
+
+func Unzip[A, B any](o Option[tuple.Pair[A, B]]) tuple.Pair[Option[A], Option[B]] {
+	if o.IsNone() {
+		return tuple.NewPair(None[A](), None[B]())
+	}
+	a, b := o.Unwrap().Unwrap()
+	return tuple.NewPair(Some(a), Some(b))
+}
+
+func Take[T any](o *Option[T]) Option[T] {
+	ret := *o
+	*o = None[T]()
+	return ret
+}
+
+func Replace[T any](o *Option[T], v T) Option[T] {
+	ret := *o
+	*o = Some(v)
+	return ret
+}
+
+func UnwrapOrElse[T any](o Option[T], f func() T) T {
+	if o.IsNone() {
+		return f()
+	}
+	return o.Unwrap()
+}
+
+func UnwrapOrDefault[T any](o Option[T]) T {
+	if o.IsNone() {
+		var zero T
+		return zero
+	}
+	return o.Unwrap()
+}
+
+func Inspect[T any](o Option[T], f func(T)) Option[T] {
+	if o.IsSome() {
+		f(o.Unwrap())
+	}
+	return o
+}
+
+func Flatten[T any](o Option[Option[T]]) Option[T] {
+	if o.IsNone() {
+		return None[T]()
+	}
+	return o.Unwrap()
+}
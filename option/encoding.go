@@ -0,0 +1,234 @@
+package option
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+var jsonNull = []byte("null")
+
+func (o oSome[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.v)
+}
+
+func (oNone[T]) MarshalJSON() ([]byte, error) {
+	return jsonNull, nil
+}
+
+type Nullable[T any] struct {
+	v     T
+	valid bool
+}
+
+func NewNullable[T any](o Option[T]) Nullable[T] {
+	if o == nil || o.IsNone() {
+		return Nullable[T]{}
+	}
+	return Nullable[T]{v: o.Unwrap(), valid: true}
+}
+
+func (n Nullable[T]) Option() Option[T] {
+	if !n.valid {
+		return None[T]()
+	}
+	return Some(n.v)
+}
+
+func (n Nullable[T]) IsSome() bool {
+	return n.valid
+}
+
+func (n Nullable[T]) IsNone() bool {
+	return !n.valid
+}
+
+func (n Nullable[T]) Expect(msg string) T {
+	if !n.valid {
+		panic(msg)
+	}
+	return n.v
+}
+
+func (n Nullable[T]) Unwrap() T {
+	if !n.valid {
+		panic("unwrap None() is not allowed")
+	}
+	return n.v
+}
+
+func (n Nullable[T]) UnwrapOr(def T) T {
+	if !n.valid {
+		return def
+	}
+	return n.v
+}
+
+func (n Nullable[T]) MarshalJSON() ([]byte, error) {
+	if !n.valid {
+		return jsonNull, nil
+	}
+	return json.Marshal(n.v)
+}
+
+func (n *Nullable[T]) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), jsonNull) {
+		*n = Nullable[T]{}
+		return nil
+	}
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*n = Nullable[T]{v: v, valid: true}
+	return nil
+}
+
+// MarshalText writes None as empty text, which UnmarshalText reads back as None, so the text form
+// cannot tell None from Some of a value with empty text, e.g. Some(""), which is read back as None.
+// Only the JSON and SQL forms keep the two apart, with null.
+func (n Nullable[T]) MarshalText() ([]byte, error) {
+	if !n.valid {
+		return []byte{}, nil
+	}
+	switch v := any(n.v).(type) {
+	case encoding.TextMarshaler:
+		return v.MarshalText()
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	}
+	return []byte(fmt.Sprint(n.v)), nil
+}
+
+func (n *Nullable[T]) UnmarshalText(text []byte) error {
+	if len(text) <= 0 {
+		*n = Nullable[T]{}
+		return nil
+	}
+	var v T
+	switch p := any(&v).(type) {
+	case encoding.TextUnmarshaler:
+		if err := p.UnmarshalText(text); err != nil {
+			return err
+		}
+	case *string:
+		*p = string(text)
+	case *[]byte:
+		*p = bytes.Clone(text)
+	default:
+		if err := parseValue(reflect.ValueOf(p).Elem(), string(text)); err != nil {
+			return fmt.Errorf("unmarshal %q into %T failed: %w", text, v, err)
+		}
+	}
+	*n = Nullable[T]{v: v, valid: true}
+	return nil
+}
+
+func (n *Nullable[T]) Scan(src any) error {
+	if src == nil {
+		*n = Nullable[T]{}
+		return nil
+	}
+	var v T
+	if err := scanValue(&v, src); err != nil {
+		return err
+	}
+	*n = Nullable[T]{v: v, valid: true}
+	return nil
+}
+
+func (n Nullable[T]) Value() (driver.Value, error) {
+	if !n.valid {
+		return nil, nil
+	}
+	if valuer, ok := any(n.v).(driver.Valuer); ok {
+		return valuer.Value()
+	}
+	return driver.DefaultParameterConverter.ConvertValue(n.v)
+}
+
+func scanValue[T any](dest *T, src any) error {
+	if scanner, ok := any(dest).(sql.Scanner); ok {
+		return scanner.Scan(src)
+	}
+	if v, ok := src.(T); ok {
+		*dest = v
+		return nil
+	}
+	switch p := any(dest).(type) {
+	case *string:
+		if bs, ok := src.([]byte); ok {
+			*p = string(bs)
+			return nil
+		}
+	case *[]byte:
+		if s, ok := src.(string); ok {
+			*p = []byte(s)
+			return nil
+		}
+	}
+	// like database/sql, numbers are converted through their text, so fractions and overflows are errors
+	var text string
+	switch v := src.(type) {
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		switch srcVal := reflect.ValueOf(src); srcVal.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			text = strconv.FormatInt(srcVal.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			text = strconv.FormatUint(srcVal.Uint(), 10)
+		case reflect.Float32, reflect.Float64:
+			text = strconv.FormatFloat(srcVal.Float(), 'g', -1, srcVal.Type().Bits())
+		case reflect.Bool:
+			text = strconv.FormatBool(srcVal.Bool())
+		default:
+			return fmt.Errorf("unsupported Scan, storing driver.Value type %T into type %T", src, dest)
+		}
+	}
+	if err := parseValue(reflect.ValueOf(dest).Elem(), text); err != nil {
+		return fmt.Errorf("converting driver.Value type %T (%q) to a %T: %w", src, text, *dest, err)
+	}
+	return nil
+}
+
+func parseValue(dest reflect.Value, text string) error {
+	switch dest.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(text, 10, dest.Type().Bits())
+		if err != nil {
+			return err
+		}
+		dest.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(text, 10, dest.Type().Bits())
+		if err != nil {
+			return err
+		}
+		dest.SetUint(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(text, dest.Type().Bits())
+		if err != nil {
+			return err
+		}
+		dest.SetFloat(v)
+	case reflect.Bool:
+		v, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		dest.SetBool(v)
+	default:
+		return fmt.Errorf("unsupported type %s", dest.Type())
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package option_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/arcane-craft/sugar/option"
+)
+
+func TestNullableJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   option.Option[string]
+		want string
+	}{
+		{"some", option.Some("hello"), `"hello"`},
+		{"empty some", option.Some(""), `""`},
+		{"none", option.None[string](), `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(option.NewNullable(tt.in))
+			if err != nil {
+				t.Fatalf("json.Marshal() failed: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Fatalf("got %s, want %s", data, tt.want)
+			}
+			var n option.Nullable[string]
+			if err := json.Unmarshal(data, &n); err != nil {
+				t.Fatalf("json.Unmarshal() failed: %v", err)
+			}
+			if n.IsSome() != tt.in.IsSome() || n.UnwrapOr("") != tt.in.UnwrapOr("") {
+				t.Errorf("got %v after round trip, want %v", n.Option(), tt.in)
+			}
+		})
+	}
+}
+
+func TestNullableUnmarshalText(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    option.Option[int8]
+		wantErr bool
+	}{
+		{text: "12", want: option.Some[int8](12)},
+		{text: "-128", want: option.Some[int8](-128)},
+		{text: "", want: option.None[int8]()},
+		{text: "12 abc", wantErr: true},
+		{text: "3.9", wantErr: true},
+		{text: "128", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			var n option.Nullable[int8]
+			err := n.UnmarshalText([]byte(tt.text))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", n.Option())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UnmarshalText() failed: %v", err)
+			}
+			if n.IsSome() != tt.want.IsSome() || n.UnwrapOr(0) != tt.want.UnwrapOr(0) {
+				t.Errorf("got %v, want %v", n.Option(), tt.want)
+			}
+		})
+	}
+}
+
+func TestNullableScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     any
+		want    option.Option[int8]
+		wantErr bool
+	}{
+		{name: "int64", src: int64(42), want: option.Some[int8](42)},
+		{name: "bytes", src: []byte("42"), want: option.Some[int8](42)},
+		{name: "integral float", src: float64(7), want: option.Some[int8](7)},
+		{name: "null", src: nil, want: option.None[int8]()},
+		{name: "fraction", src: 3.9, wantErr: true},
+		{name: "overflow", src: int64(1000), wantErr: true},
+		{name: "trailing text", src: "42x", wantErr: true},
+		{name: "unsupported", src: struct{}{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n option.Nullable[int8]
+			err := n.Scan(tt.src)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", n.Option())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Scan() failed: %v", err)
+			}
+			if n.IsSome() != tt.want.IsSome() || n.UnwrapOr(0) != tt.want.UnwrapOr(0) {
+				t.Errorf("got %v, want %v", n.Option(), tt.want)
+			}
+		})
+	}
+}
+
+func TestNullableValue(t *testing.T) {
+	tests := []struct {
+		name string
+		in   option.Option[int64]
+		want any
+	}{
+		{"some", option.Some[int64](42), int64(42)},
+		{"none", option.None[int64](), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := option.NewNullable(tt.in).Value()
+			if err != nil {
+				t.Fatalf("Value() failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package option
+
+import (
+	"errors"
+)
+
+var ErrNone = errors.New("option: none value")
+
+func FromComma[T any](v T, ok bool) Option[T] {
+	if !ok {
+		return None[T]()
+	}
+	return Some(v)
+}
+
+func FromPtr[T any](p *T) Option[T] {
+	if p == nil {
+		return None[T]()
+	}
+	return Some(*p)
+}
+
+func ToPtr[T any](o Option[T]) *T {
+	if o.IsNone() {
+		return nil
+	}
+	v := o.Unwrap()
+	return &v
+}
@@ -0,0 +1,105 @@
+package result
+
+import (
+	"github.com/arcane-craft/sugar/option"
+)
+
+func Map[T, U any](r Result[T], f func(T) U) Result[U] {
+	if r.IsErr() {
+		return Err[U](r.UnwrapErr())
+	}
+	return Ok(f(r.Unwrap()))
+}
+
+func MapOr[T, U any](r Result[T], def U, f func(T) U) U {
+	if r.IsErr() {
+		return def
+	}
+	return f(r.Unwrap())
+}
+
+func MapOrElse[T, U any](r Result[T], def func(error) U, f func(T) U) U {
+	if r.IsErr() {
+		return def(r.UnwrapErr())
+	}
+	return f(r.Unwrap())
+}
+
+func AndThen[T, U any](r Result[T], f func(T) Result[U]) Result[U] {
+	if r.IsErr() {
+		return Err[U](r.UnwrapErr())
+	}
+	return f(r.Unwrap())
+}
+
+func FlatMap[T, U any](r Result[T], f func(T) Result[U]) Result[U] {
+	return AndThen(r, f)
+}
+
+func And[T, U any](r Result[T], res Result[U]) Result[U] {
+	if r.IsErr() {
+		return Err[U](r.UnwrapErr())
+	}
+	return res
+}
+
+func Or[T any](r Result[T], res Result[T]) Result[T] {
+	if r.IsErr() {
+		return res
+	}
+	return r
+}
+
+func OrElse[T any](r Result[T], f func(error) Result[T]) Result[T] {
+	if r.IsErr() {
+		return f(r.UnwrapErr())
+	}
+	return r
+}
+
+func UnwrapOrElse[T any](r Result[T], f func(error) T) T {
+	if r.IsErr() {
+		return f(r.UnwrapErr())
+	}
+	return r.Unwrap()
+}
+
+func UnwrapOrDefault[T any](r Result[T]) T {
+	if r.IsErr() {
+		var zero T
+		return zero
+	}
+	return r.Unwrap()
+}
+
+func Inspect[T any](r Result[T], f func(T)) Result[T] {
+	if r.IsOk() {
+		f(r.Unwrap())
+	}
+	return r
+}
+
+func InspectErr[T any](r Result[T], f func(error)) Result[T] {
+	if r.IsErr() {
+		f(r.UnwrapErr())
+	}
+	return r
+}
+
+func Flatten[T any](r Result[Result[T]]) Result[T] {
+	if r.IsErr() {
+		return Err[T](r.UnwrapErr())
+	}
+	return r.Unwrap()
+}
+
+func Transpose[T any](r Result[option.Option[T]]) option.Option[Result[T]] {
+	if r.IsErr() {
+		return option.Some(Err[T](r.UnwrapErr()))
+	}
+	o := r.Unwrap()
+	if o.IsNone() {
+		return option.None[Result[T]]()
+	}
+	return option.Some(Ok(o.Unwrap()))
+}
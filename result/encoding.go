@@ -0,0 +1,77 @@
+package result
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var jsonNull = []byte("null")
+
+type okJSON[T any] struct {
+	Ok T `json:"ok"`
+}
+
+type errJSON struct {
+	Err string `json:"err"`
+}
+
+type taggedJSON struct {
+	Ok  json.RawMessage `json:"ok"`
+	Err *string         `json:"err"`
+}
+
+func (r rOk[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(okJSON[T]{Ok: r.v})
+}
+
+func (r rErr[T]) MarshalJSON() ([]byte, error) {
+	var msg string
+	if r.v != nil {
+		msg = r.v.Error()
+	}
+	return json.Marshal(errJSON{Err: msg})
+}
+
+type Tagged[T any] struct {
+	Result Result[T]
+}
+
+func NewTagged[T any](r Result[T]) Tagged[T] {
+	return Tagged[T]{r}
+}
+
+func (t Tagged[T]) MarshalJSON() ([]byte, error) {
+	if t.Result == nil {
+		return jsonNull, nil
+	}
+	return json.Marshal(t.Result)
+}
+
+func (t *Tagged[T]) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), jsonNull) {
+		t.Result = nil
+		return nil
+	}
+	var tagged taggedJSON
+	if err := json.Unmarshal(data, &tagged); err != nil {
+		return err
+	}
+	if tagged.Err != nil {
+		if tagged.Ok != nil {
+			return fmt.Errorf("result contains both \"ok\" and \"err\"")
+		}
+		t.Result = Err[T](errors.New(*tagged.Err))
+		return nil
+	}
+	if tagged.Ok == nil {
+		return fmt.Errorf("result contains neither \"ok\" nor \"err\"")
+	}
+	var v T
+	if err := json.Unmarshal(tagged.Ok, &v); err != nil {
+		return err
+	}
+	t.Result = Ok(v)
+	return nil
+}
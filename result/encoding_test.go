@@ -0,0 +1,56 @@
+package result_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/arcane-craft/sugar/result"
+)
+
+func TestTaggedJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   result.Result[int]
+		want string
+	}{
+		{"ok", result.Ok(42), `{"ok":42}`},
+		{"err", result.Err[int](errors.New("failed")), `{"err":"failed"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(result.NewTagged(tt.in))
+			if err != nil {
+				t.Fatalf("json.Marshal() failed: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Fatalf("got %s, want %s", data, tt.want)
+			}
+			var tagged result.Tagged[int]
+			if err := json.Unmarshal(data, &tagged); err != nil {
+				t.Fatalf("json.Unmarshal() failed: %v", err)
+			}
+			got := tagged.Result
+			if got.IsOk() != tt.in.IsOk() {
+				t.Fatalf("got %v after round trip, want %v", got, tt.in)
+			}
+			if tt.in.IsOk() && got.Unwrap() != tt.in.Unwrap() {
+				t.Errorf("got %d after round trip, want %d", got.Unwrap(), tt.in.Unwrap())
+			}
+			if tt.in.IsErr() && got.UnwrapErr().Error() != tt.in.UnwrapErr().Error() {
+				t.Errorf("got %q after round trip, want %q", got.UnwrapErr(), tt.in.UnwrapErr())
+			}
+		})
+	}
+}
+
+func TestTaggedUnmarshalJSONInvalid(t *testing.T) {
+	for _, data := range []string{`{}`, `{"ok":1,"err":"failed"}`, `{"ok":"text"}`} {
+		t.Run(data, func(t *testing.T) {
+			var tagged result.Tagged[int]
+			if err := json.Unmarshal([]byte(data), &tagged); err == nil {
+				t.Errorf("got %v, want an error", tagged.Result)
+			}
+		})
+	}
+}
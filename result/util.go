@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/arcane-craft/sugar"
+	"github.com/arcane-craft/sugar/option"
 	"github.com/arcane-craft/sugar/tuple"
 )
 
@@ -35,6 +36,20 @@ func From3[A, B, C any](r1 A, r2 B, r3 C, e error) Result[tuple.Triple[A, B, C]]
 	return Ok(tuple.NewTriple(r1, r2, r3))
 }
 
+func OkOr[T any](o option.Option[T], e error) Result[T] {
+	if o.IsNone() {
+		return Err[T](e)
+	}
+	return Ok(o.Unwrap())
+}
+
+func OkOrElse[T any](o option.Option[T], f func() error) Result[T] {
+	if o.IsNone() {
+		return Err[T](f())
+	}
+	return Ok(o.Unwrap())
+}
+
 func WrapErr[T any](desc string, r *Result[T]) {
 	if r != nil && *r != nil {
 		*r = (*r).MapErr(func(err error) error {
@@ -0,0 +1,91 @@
+package analyzer
+
+import (
+	"go/token"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/packages"
+
+	"github.com/arcane-craft/sugar/tool/transform/lib"
+
+	// registers the built-in syntaxes
+	_ "github.com/arcane-craft/sugar/tool/transform/syntaxes"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name: "sugar",
+	Doc:  "report sugar syntax calls that the transform tool cannot lower",
+	URL:  "https://github.com/arcane-craft/sugar",
+	Run:  run,
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	imports := make(map[string]*packages.Package)
+	for _, dep := range pass.Pkg.Imports() {
+		imports[dep.Path()] = &packages.Package{ID: dep.Path(), Name: dep.Name(), PkgPath: dep.Path(), Types: dep}
+	}
+	pkg := &packages.Package{
+		ID:        pass.Pkg.Path(),
+		Name:      pass.Pkg.Name(),
+		PkgPath:   pass.Pkg.Path(),
+		Fset:      pass.Fset,
+		Syntax:    pass.Files,
+		Types:     pass.Pkg,
+		TypesInfo: pass.TypesInfo,
+		Imports:   imports,
+	}
+
+	// syntaxes registered by custom transform binaries are checked as well as the built-in ones
+	programs, err := lib.Programs(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	diagnostics := lib.Inspect(pkg, programs)
+
+	files := make(map[string]*token.File)
+	for _, f := range pass.Files {
+		if tf := pass.Fset.File(f.Pos()); tf != nil {
+			files[tf.Name()] = tf
+		}
+	}
+	toPos := func(pos token.Position) token.Pos {
+		tf, ok := files[pos.Filename]
+		if !ok || pos.Offset > tf.Size() {
+			return token.NoPos
+		}
+		return tf.Pos(pos.Offset)
+	}
+
+	for _, d := range diagnostics {
+		pos := toPos(d.Pos)
+		if !pos.IsValid() {
+			continue
+		}
+		var fixes []analysis.SuggestedFix
+		for _, fix := range d.Fixes {
+			suggested := analysis.SuggestedFix{Message: fix.Message}
+			for _, edit := range fix.Edits {
+				start, end := toPos(edit.Old.Start), toPos(edit.Old.End)
+				if !start.IsValid() || !end.IsValid() {
+					suggested.TextEdits = nil
+					break
+				}
+				suggested.TextEdits = append(suggested.TextEdits, analysis.TextEdit{
+					Pos:     start,
+					End:     end,
+					NewText: []byte(edit.New),
+				})
+			}
+			if len(suggested.TextEdits) > 0 {
+				fixes = append(fixes, suggested)
+			}
+		}
+		pass.Report(analysis.Diagnostic{
+			Pos:            pos,
+			Category:       d.Syntax,
+			Message:        d.Reason,
+			SuggestedFixes: fixes,
+		})
+	}
+	return nil, nil
+}
@@ -0,0 +1,471 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/arcane-craft/sugar/tool/transform/lib"
+	"github.com/arcane-craft/sugar/tool/transform/question"
+	"github.com/arcane-craft/sugar/tool/transform/tryfunc"
+
+	// registers the built-in syntaxes
+	_ "github.com/arcane-craft/sugar/tool/transform/syntaxes"
+)
+
+// Version is printed by the version command, the module version is used if it is empty.
+var Version string
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, args []string) int
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"transform", "generate production code for sugar syntax", runTransform},
+		{"clean", "remove generated code and build directives", runClean},
+		{"check", "exit with a non-zero code if the generated code is stale", runCheck},
+		{"overlay", "write a go build -overlay file mapping sources to generated code", runOverlay},
+		{"toolexec", "desugar packages on the fly with go build -toolexec", runToolExec},
+		{"cover", "rewrite a coverage profile of generated code onto the sugared sources", runCover},
+		{"list-syntax", "list available syntaxes", runListSyntax},
+		{"version", "print the version of the tool", runVersion},
+	}
+}
+
+// Main runs the tool with the arguments following the program name and returns the exit code:
+// 0 on success, 1 if there are diagnostics or stale files, and 2 on errors. A custom
+// transform binary registers its syntaxes with lib.RegisterSyntax and then calls Main.
+func Main(args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "help", "-h", "-help", "--help":
+			usage()
+			return 0
+		}
+		for _, cmd := range commands {
+			if cmd.name == args[0] {
+				return cmd.run(ctx, args[1:])
+			}
+		}
+	}
+	return runLegacy(ctx, args)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags] [packages]\n\ncommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", cmd.name, cmd.usage)
+	}
+}
+
+type options struct {
+	cfg     lib.Config
+	tags    string
+	syntax  string
+	disable string
+	noneErr string
+	tryWrap string
+	force   bool
+	watch   bool
+}
+
+func newFlagSet(name string, opts *options, withSyntax bool) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&opts.cfg.RootDir, "root", ".", "root directory of the project")
+	fs.StringVar(&opts.tags, "tags", "", "comma-separated list of additional build tags")
+	fs.BoolVar(&opts.cfg.Verbose, "v", false, "print progress information")
+	if withSyntax {
+		fs.StringVar(&opts.syntax, "syntax", os.Getenv("SUGAR_AVAILABLE_SYNTAX"), "comma-separated list of enabled syntaxes (default all)")
+		fs.StringVar(&opts.disable, "disable", "", "comma-separated list of disabled syntaxes")
+		fs.StringVar(&opts.noneErr, "none-error", os.Getenv("SUGAR_NONE_ERROR"), "error variable returned when Q() is applied to None(), qualified by its import path, e.g. io.EOF")
+		fs.StringVar(&opts.tryWrap, "try-wrap", os.Getenv("SUGAR_TRY_WRAP"), "wrapping of the errors returned by Try(): none, func or call (default none)")
+		fs.IntVar(&opts.cfg.Jobs, "j", runtime.GOMAXPROCS(0), "number of files generated in parallel")
+	}
+	return fs
+}
+
+func (o *options) parse(fs *flag.FlagSet, args []string) (exitCode int, ok bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0, false
+		}
+		return 2, false
+	}
+	o.cfg.Patterns = fs.Args()
+	o.cfg.BuildTags = splitList(o.tags)
+	return 0, true
+}
+
+func (o *options) programs() ([]lib.Program, error) {
+	programs, err := lib.Programs(splitList(o.syntax), splitList(o.disable))
+	if err != nil {
+		return nil, err
+	}
+	if len(o.noneErr) > 0 {
+		noneErr, err := question.ParseNoneErr(o.noneErr)
+		if err != nil {
+			return nil, err
+		}
+		for idx, p := range programs {
+			if _, ok := p.(*question.Translator); ok {
+				programs[idx] = &question.Translator{NoneErr: noneErr}
+			}
+		}
+	}
+	if len(o.tryWrap) > 0 {
+		wrap, err := tryfunc.ParseWrapMode(o.tryWrap)
+		if err != nil {
+			return nil, err
+		}
+		for idx, p := range programs {
+			if _, ok := p.(*tryfunc.Translator); ok {
+				programs[idx] = &tryfunc.Translator{Wrap: wrap}
+			}
+		}
+	}
+	return programs, nil
+}
+
+func splitList(s string) []string {
+	var ret []string
+	for _, elem := range strings.Split(s, ",") {
+		if elem = strings.TrimSpace(elem); len(elem) > 0 {
+			ret = append(ret, elem)
+		}
+	}
+	return ret
+}
+
+func runLegacy(ctx context.Context, args []string) int {
+	var opts options
+	fs := newFlagSet("transform", &opts, true)
+	dryRun := fs.Bool("dry-run", false, "print a unified diff of the files that would be created, modified or removed")
+	check := fs.Bool("check", false, "exit with a non-zero code if the generated files are stale")
+	fs.BoolVar(&opts.force, "force", false, "regenerate all packages instead of only the changed ones")
+	fs.BoolVar(&opts.watch, "watch", false, "keep running and transform the changed packages whenever a .go file changes")
+	if exitCode, ok := opts.parse(fs, args); !ok {
+		return exitCode
+	}
+	if fs.NArg() > 0 {
+		opts.cfg.RootDir = fs.Arg(0)
+		opts.cfg.Patterns = nil
+	}
+	return transformWith(ctx, &opts, "", *dryRun || *check, *check, *dryRun)
+}
+
+func runTransform(ctx context.Context, args []string) int {
+	var opts options
+	fs := newFlagSet("transform", &opts, true)
+	outDir := fs.String("o", "", "write the transformed project into this directory instead of in place")
+	dryRun := fs.Bool("dry-run", false, "print a unified diff of the files that would be created, modified or removed")
+	fs.BoolVar(&opts.force, "force", false, "regenerate all packages instead of only the changed ones")
+	fs.BoolVar(&opts.watch, "watch", false, "keep running and transform the changed packages whenever a .go file changes")
+	if exitCode, ok := opts.parse(fs, args); !ok {
+		return exitCode
+	}
+	return transformWith(ctx, &opts, *outDir, *dryRun, false, *dryRun)
+}
+
+func runCheck(ctx context.Context, args []string) int {
+	var opts options
+	fs := newFlagSet("check", &opts, true)
+	diff := fs.Bool("diff", false, "print a unified diff of the stale files")
+	if exitCode, ok := opts.parse(fs, args); !ok {
+		return exitCode
+	}
+	return transformWith(ctx, &opts, "", true, true, *diff)
+}
+
+func runOverlay(ctx context.Context, args []string) int {
+	var opts options
+	fs := newFlagSet("overlay", &opts, true)
+	output := fs.String("o", "sugar.json", "path of the overlay file")
+	cacheDir := fs.String("cache", "", "directory for the generated code (default in the user cache directory)")
+	if exitCode, ok := opts.parse(fs, args); !ok {
+		return exitCode
+	}
+	programs, err := opts.programs()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(*cacheDir) <= 0 {
+		if *cacheDir, err = lib.DefaultOverlayCacheDir(opts.cfg.RootDir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	overlay, err := lib.BuildOverlay(ctx, opts.cfg.RootDir, *cacheDir, transformer(&opts.cfg, programs))
+	diagnostics, err := splitDiagnostics(err)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := overlay.Save(*output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	opts.cfg.Logf("write overlay %s", *output)
+	return reportDiagnostics(diagnostics)
+}
+
+func runCover(ctx context.Context, args []string) int {
+	var opts options
+	fs := newFlagSet("cover", &opts, false)
+	output := fs.String("o", "", "path of the rewritten profile (default standard output)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s cover [flags] cover.out\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if exitCode, ok := opts.parse(fs, args); !ok {
+		return exitCode
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	opts.cfg.Patterns = nil
+	in, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer in.Close()
+	buf := bytes.NewBuffer(nil)
+	if err := lib.RemapCoverProfile(ctx, &opts.cfg, in, buf); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(*output) <= 0 {
+		os.Stdout.Write(buf.Bytes())
+		return 0
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	return 0
+}
+
+func runClean(ctx context.Context, args []string) int {
+	var opts options
+	fs := newFlagSet("clean", &opts, false)
+	if exitCode, ok := opts.parse(fs, args); !ok {
+		return exitCode
+	}
+	if err := lib.Clean(ctx, &opts.cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	return 0
+}
+
+func runListSyntax(context.Context, []string) int {
+	for _, name := range lib.SyntaxNames() {
+		fmt.Println(name)
+	}
+	return 0
+}
+
+func runVersion(context.Context, []string) int {
+	v := Version
+	if len(v) <= 0 {
+		v = "(devel)"
+		if info, ok := debug.ReadBuildInfo(); ok && len(info.Main.Version) > 0 {
+			v = info.Main.Version
+		}
+	}
+	fmt.Println("sugar", v)
+	return 0
+}
+
+func transformWith(ctx context.Context, opts *options, outDir string, dryRun bool, check bool, printDiff bool) int {
+	programs, err := opts.programs()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	cfg := &opts.cfg
+	if opts.watch {
+		if dryRun || len(outDir) > 0 {
+			fmt.Fprintln(os.Stderr, "-watch cannot be combined with -o, -dry-run or -check")
+			return 2
+		}
+		return watchTransform(ctx, opts, programs)
+	}
+
+	transformAt := transformer(cfg, programs)
+	if !dryRun {
+		var diagnostics lib.Diagnostics
+		switch {
+		case len(outDir) > 0:
+			_, err = lib.OutOfTree(ctx, cfg.RootDir, outDir, transformAt)
+			diagnostics, err = splitDiagnostics(err)
+		case !opts.force:
+			diagnostics, err = transformIncremental(ctx, opts, programs)
+		default:
+			diagnostics, err = splitDiagnostics(transformAt(ctx, cfg.RootDir))
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		return reportDiagnostics(diagnostics)
+	}
+
+	changes, err := lib.DryRun(ctx, cfg.RootDir, transformAt)
+	diagnostics, err := splitDiagnostics(err)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if printDiff {
+		for _, c := range changes {
+			fmt.Print(c.UnifiedDiff())
+		}
+	}
+	exitCode := reportDiagnostics(diagnostics)
+	if check && len(changes) > 0 {
+		for _, c := range changes {
+			fmt.Fprintln(os.Stderr, "stale:", c)
+		}
+		exitCode = 1
+	}
+	return exitCode
+}
+
+func transformIncremental(ctx context.Context, opts *options, programs []lib.Program) (lib.Diagnostics, error) {
+	exeHash, err := executableHash()
+	if err != nil {
+		return nil, err
+	}
+	cachePath, err := lib.DefaultCachePath(opts.cfg.RootDir)
+	if err != nil {
+		return nil, err
+	}
+	salt := strings.Join([]string{exeHash, opts.tags, opts.syntax, opts.disable, opts.noneErr, opts.tryWrap}, "\n")
+	cache, err := lib.LoadCache(cachePath, salt)
+	if err != nil {
+		return nil, fmt.Errorf("load cache failed: %w", err)
+	}
+
+	err = lib.Incremental(ctx, &opts.cfg, cache, func(ctx context.Context, cfg *lib.Config) error {
+		return transformer(cfg, programs)(ctx, cfg.RootDir)
+	})
+	return splitDiagnostics(err)
+}
+
+// transformer runs the programs in place at a root directory, returning the diagnostics as
+// its error so that runs in copies of the tree report them at the paths of the original one
+func transformer(cfg *lib.Config, programs []lib.Program) func(ctx context.Context, rootDir string) error {
+	return func(ctx context.Context, rootDir string) error {
+		diags, err := lib.Transform(ctx, cfg.WithRootDir(rootDir), programs)
+		if err != nil {
+			return err
+		}
+		if len(diags) > 0 {
+			return diags
+		}
+		return nil
+	}
+}
+
+func splitDiagnostics(err error) (lib.Diagnostics, error) {
+	var diagnostics lib.Diagnostics
+	if errors.As(err, &diagnostics) {
+		return diagnostics, nil
+	}
+	return nil, err
+}
+
+func watchTransform(ctx context.Context, opts *options, programs []lib.Program) int {
+	var last string
+	diagnosticsByDir := make(map[string]lib.Diagnostics)
+	// dirs are the packages to transform again, or nil for all of them
+	transformChanged := func(ctx context.Context, dirs map[string]bool, patterns []string) {
+		runOpts := *opts
+		if dirs != nil {
+			runOpts.cfg = *opts.cfg.WithPatterns(patterns)
+		}
+		var diagnostics lib.Diagnostics
+		if dirs == nil || len(patterns) > 0 {
+			// a run in progress is finished on interrupt, so the tree is never left with temporary build tags
+			var err error
+			diagnostics, err = transformIncremental(context.WithoutCancel(ctx), &runOpts, programs)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return
+			}
+		}
+		if dirs == nil {
+			clear(diagnosticsByDir)
+		}
+		for dir := range dirs {
+			delete(diagnosticsByDir, dir)
+		}
+		for _, d := range diagnostics {
+			dir := filepath.Dir(d.Pos.Filename)
+			diagnosticsByDir[dir] = append(diagnosticsByDir[dir], d)
+		}
+		var all lib.Diagnostics
+		for _, diags := range diagnosticsByDir {
+			all = append(all, diags...)
+		}
+		all.Sort()
+		if report := all.Error(); report != last {
+			last = report
+			if reportDiagnostics(all) == 0 {
+				fmt.Fprintln(os.Stderr, "no diagnostics")
+			}
+		}
+	}
+
+	transformChanged(ctx, nil, nil)
+	fmt.Fprintf(os.Stderr, "watching %s for changes\n", opts.cfg.RootDir)
+	err := watch(ctx, &opts.cfg, 300*time.Millisecond, func(ctx context.Context, files []string) {
+		for _, file := range files {
+			opts.cfg.Logf("changed %s", file)
+		}
+		dirs, patterns, ok := changedPackages(&opts.cfg, files)
+		if !ok {
+			dirs, patterns = nil, nil
+		} else if len(dirs) <= 0 {
+			return
+		}
+		transformChanged(ctx, dirs, patterns)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	return 0
+}
+
+func reportDiagnostics(diagnostics lib.Diagnostics) int {
+	if len(diagnostics) <= 0 {
+		return 0
+	}
+	diagnostics.Sort()
+	for _, d := range diagnostics {
+		fmt.Fprintln(os.Stderr, d)
+	}
+	return 1
+}
@@ -0,0 +1,437 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/arcane-craft/sugar/tool/transform/lib"
+)
+
+const sugarPkgPrefix = "github.com/arcane-craft/sugar/"
+
+func runToolExec(ctx context.Context, args []string) int {
+	if len(args) <= 0 {
+		fmt.Fprintln(os.Stderr, "usage: go build -toolexec=\"sugar toolexec\" [packages]")
+		return 2
+	}
+	tool, toolArgs := args[0], slices.Clone(args[1:])
+	toolName := strings.TrimSuffix(filepath.Base(tool), ".exe")
+
+	if slices.Equal(toolArgs, []string{"-V=full"}) {
+		return printToolID(ctx, tool, toolArgs)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "sugar-toolexec-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "sugar toolexec:", err)
+		return 2
+	}
+	defer os.RemoveAll(tmpDir)
+
+	switch toolName {
+	case "compile":
+		err = desugarCompile(ctx, toolArgs, tmpDir)
+	case "link":
+		err = extendLinkImports(ctx, toolArgs, tmpDir)
+	}
+	if err != nil {
+		var diags lib.Diagnostics
+		if errors.As(err, &diags) {
+			return reportDiagnostics(diags)
+		}
+		fmt.Fprintln(os.Stderr, "sugar toolexec:", err)
+		return 2
+	}
+
+	cmd := exec.CommandContext(ctx, tool, toolArgs...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return runTool(cmd)
+}
+
+func runTool(cmd *exec.Cmd) int {
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		fmt.Fprintln(os.Stderr, "sugar toolexec:", err)
+		return 2
+	}
+	return 0
+}
+
+// the go command keys its build cache on this output, so it must change with the generated code
+func printToolID(ctx context.Context, tool string, args []string) int {
+	stdout := new(bytes.Buffer)
+	cmd := exec.CommandContext(ctx, tool, args...)
+	cmd.Stdout, cmd.Stderr = stdout, os.Stderr
+	if exitCode := runTool(cmd); exitCode != 0 {
+		return exitCode
+	}
+	id, err := toolExecID()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "sugar toolexec:", err)
+		return 2
+	}
+	fields := strings.Fields(stdout.String())
+	if len(fields) > 0 && strings.HasPrefix(fields[len(fields)-1], "buildID=") {
+		fields[len(fields)-1] += "+sugar" + id
+	} else {
+		fields = append(fields, "sugar:"+id)
+	}
+	fmt.Println(strings.Join(fields, " "))
+	return 0
+}
+
+func toolExecID() (string, error) {
+	exeHash, err := executableHash()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n%s\n%s\n", exeHash, os.Getenv("SUGAR_AVAILABLE_SYNTAX"), os.Getenv("SUGAR_NONE_ERROR"), os.Getenv("SUGAR_TRY_WRAP"))
+	return hex.EncodeToString(hash.Sum(nil)[:8]), nil
+}
+
+func executableHash() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("os.Executable() failed: %w", err)
+	}
+	file, err := os.Open(exe)
+	if err != nil {
+		return "", fmt.Errorf("os.Open() failed: %w", err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("io.Copy() failed: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func flagValue(args []string, name string) (int, string) {
+	for idx, arg := range args {
+		if arg == name && idx+1 < len(args) {
+			return idx + 1, args[idx+1]
+		}
+		if strings.HasPrefix(arg, name+"=") {
+			return idx, strings.TrimPrefix(arg, name+"=")
+		}
+	}
+	return -1, ""
+}
+
+func setFlagValue(args []string, idx int, name string, value string) {
+	if strings.HasPrefix(args[idx], name+"=") {
+		args[idx] = name + "=" + value
+	} else {
+		args[idx] = value
+	}
+}
+
+func fileImports(path string) ([]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ImportsOnly)
+	if err != nil {
+		return nil, fmt.Errorf("parser.ParseFile() failed: %w", err)
+	}
+	var imports []string
+	for _, spec := range file.Imports {
+		if path, err := strconv.Unquote(spec.Path.Value); err == nil {
+			imports = append(imports, path)
+		}
+	}
+	return imports, nil
+}
+
+func usesSugar(path string) bool {
+	imports, err := fileImports(path)
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(imports, func(p string) bool {
+		return strings.HasPrefix(p, sugarPkgPrefix)
+	})
+}
+
+func desugarCompile(ctx context.Context, args []string, tmpDir string) error {
+	var pkgDir string
+	var files []int
+	for idx, arg := range args {
+		if !strings.HasSuffix(arg, ".go") {
+			continue
+		}
+		files = append(files, idx)
+		if len(pkgDir) <= 0 && usesSugar(arg) {
+			abs, err := filepath.Abs(arg)
+			if err != nil {
+				return fmt.Errorf("filepath.Abs() failed: %w", err)
+			}
+			pkgDir = filepath.Dir(abs)
+		}
+	}
+	if len(pkgDir) <= 0 {
+		return nil
+	}
+
+	opts := &options{
+		syntax:  os.Getenv("SUGAR_AVAILABLE_SYNTAX"),
+		noneErr: os.Getenv("SUGAR_NONE_ERROR"),
+		tryWrap: os.Getenv("SUGAR_TRY_WRAP"),
+	}
+	programs, err := opts.programs()
+	if err != nil {
+		return err
+	}
+	cfg := &lib.Config{Patterns: []string{"."}}
+
+	dstDir, err := lib.PackageOutOfTree(ctx, pkgDir, filepath.Join(tmpDir, "module"), transformer(cfg, programs))
+	if err != nil {
+		return err
+	}
+
+	srcDir := filepath.Join(tmpDir, "src")
+	if err := os.MkdirAll(srcDir, 0755); err != nil {
+		return fmt.Errorf("os.MkdirAll() failed: %w", err)
+	}
+	imports := make(map[string]bool)
+	for _, idx := range files {
+		abs, err := filepath.Abs(args[idx])
+		if err != nil {
+			return fmt.Errorf("filepath.Abs() failed: %w", err)
+		}
+		file := args[idx]
+		if filepath.Dir(abs) == pkgDir {
+			content, err := os.ReadFile(lib.ProductionFileName(filepath.Join(dstDir, filepath.Base(abs))))
+			if err == nil {
+				if content, err = lib.SubstituteSource(content, abs); err != nil {
+					return err
+				}
+				file = filepath.Join(srcDir, filepath.Base(abs))
+				if err := os.WriteFile(file, content, 0644); err != nil {
+					return fmt.Errorf("os.WriteFile() failed: %w", err)
+				}
+				args[idx] = file
+			}
+		}
+		fileImports, err := fileImports(file)
+		if err != nil {
+			return err
+		}
+		for _, path := range fileImports {
+			imports[path] = true
+		}
+	}
+
+	cfgIdx, importCfg := flagValue(args, "-importcfg")
+	if cfgIdx < 0 {
+		return nil
+	}
+	known, err := readImportCfg(importCfg)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for path := range imports {
+		if _, ok := known[path]; !ok && path != "unsafe" && path != "C" {
+			missing = append(missing, path)
+		}
+	}
+	if len(missing) <= 0 {
+		return nil
+	}
+	slices.Sort(missing)
+
+	_, buildID := flagValue(args, "-buildid")
+	actionID, _, _ := strings.Cut(buildID, "/")
+	if err := saveExtraImports(actionID, missing); err != nil {
+		return err
+	}
+	newCfg := filepath.Join(tmpDir, "importcfg")
+	if err := extendImportCfg(ctx, importCfg, newCfg, missing, false); err != nil {
+		return err
+	}
+	setFlagValue(args, cfgIdx, "-importcfg", newCfg)
+	return nil
+}
+
+func extendLinkImports(ctx context.Context, args []string, tmpDir string) error {
+	cfgIdx, importCfg := flagValue(args, "-importcfg")
+	if cfgIdx < 0 {
+		return nil
+	}
+	known, err := readImportCfg(importCfg)
+	if err != nil {
+		return err
+	}
+	missingSet := make(map[string]bool)
+	for _, archive := range known {
+		actionID := archiveActionID(archive)
+		if len(actionID) <= 0 {
+			continue
+		}
+		extras, err := loadExtraImports(actionID)
+		if err != nil {
+			return err
+		}
+		for _, extra := range extras {
+			if _, ok := known[extra]; !ok {
+				missingSet[extra] = true
+			}
+		}
+	}
+	if len(missingSet) <= 0 {
+		return nil
+	}
+	var missing []string
+	for path := range missingSet {
+		missing = append(missing, path)
+	}
+	slices.Sort(missing)
+
+	newCfg := filepath.Join(tmpDir, "importcfg.link")
+	if err := extendImportCfg(ctx, importCfg, newCfg, missing, true); err != nil {
+		return err
+	}
+	setFlagValue(args, cfgIdx, "-importcfg", newCfg)
+	return nil
+}
+
+// the packages of an import config, with their archive files if they are given by packagefile
+func readImportCfg(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("os.Open() failed: %w", err)
+	}
+	defer file.Close()
+	known := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		verb, args, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if verb == "packagefile" || verb == "importmap" {
+			if pkg, archive, ok := strings.Cut(args, "="); ok {
+				if verb == "importmap" {
+					archive = ""
+				}
+				known[pkg] = archive
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan %s failed: %w", path, err)
+	}
+	return known, nil
+}
+
+func extendImportCfg(ctx context.Context, oldCfg string, newCfg string, missing []string, deps bool) error {
+	content, err := os.ReadFile(oldCfg)
+	if err != nil {
+		return fmt.Errorf("os.ReadFile() failed: %w", err)
+	}
+	known, err := readImportCfg(oldCfg)
+	if err != nil {
+		return err
+	}
+
+	listArgs := []string{"list", "-export", "-f", "{{if .Export}}{{.ImportPath}}={{.Export}}{{end}}"}
+	if deps {
+		listArgs = append(listArgs, "-deps")
+	}
+	cmd := exec.CommandContext(ctx, "go", append(listArgs, missing...)...)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", cmd.String(), err)
+	}
+
+	buf := bytes.NewBuffer(content)
+	if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if pkg, _, ok := strings.Cut(line, "="); ok {
+			if _, found := known[pkg]; found {
+				continue
+			}
+			fmt.Fprintf(buf, "packagefile %s\n", line)
+		}
+	}
+	if err := os.WriteFile(newCfg, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("os.WriteFile() failed: %w", err)
+	}
+	return nil
+}
+
+// the compile step may be served from the build cache, so the extra imports of
+// desugared packages are remembered for the link step. They are keyed by the action ID
+// the go command gives the compilation, which it records in the archive, so packages of
+// the same path in different projects, e.g. main, never share them.
+func extraImportsFile(actionID string) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("os.UserCacheDir() failed: %w", err)
+	}
+	sum := sha256.Sum256([]byte(actionID))
+	return filepath.Join(cacheDir, "sugar", "toolexec", hex.EncodeToString(sum[:8])), nil
+}
+
+// the action ID part of the build ID in the header of a compiled archive
+func archiveActionID(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	header := make([]byte, 1024)
+	n, _ := io.ReadFull(file, header)
+	_, buildID, ok := bytes.Cut(header[:n], []byte("\nbuild id \""))
+	if !ok {
+		return ""
+	}
+	buildID, _, _ = bytes.Cut(buildID, []byte("\""))
+	actionID, _, _ := bytes.Cut(buildID, []byte("/"))
+	return string(actionID)
+}
+
+func saveExtraImports(actionID string, imports []string) error {
+	path, err := extraImportsFile(actionID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("os.MkdirAll() failed: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(imports, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("os.WriteFile() failed: %w", err)
+	}
+	return nil
+}
+
+func loadExtraImports(actionID string) ([]string, error) {
+	path, err := extraImportsFile(actionID)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("os.ReadFile() failed: %w", err)
+	}
+	return strings.Fields(string(content)), nil
+}
@@ -0,0 +1,237 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/arcane-craft/sugar/tool/transform/lib"
+)
+
+func watchable(path string) bool {
+	return strings.HasSuffix(path, ".go") && !lib.IsProductionFile(path)
+}
+
+func skipWatchDir(rootDir string, path string, d fs.DirEntry) bool {
+	if path == rootDir {
+		return false
+	}
+	name := d.Name()
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") ||
+		name == "testdata" || name == "vendor"
+}
+
+func addWatchTree(watcher *fsnotify.Watcher, rootDir string, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if skipWatchDir(rootDir, path, d) {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
+
+func watchNotify(ctx context.Context, rootDir string, changes chan<- string) (func(), error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := addWatchTree(watcher, rootDir, rootDir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Has(fsnotify.Create) {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						_ = addWatchTree(watcher, rootDir, event.Name)
+					}
+				}
+				if !watchable(event.Name) || event.Op == fsnotify.Chmod {
+					continue
+				}
+				select {
+				case changes <- event.Name:
+				case <-ctx.Done():
+					return
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+	return func() { watcher.Close() }, nil
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func scanTree(rootDir string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	_ = filepath.WalkDir(rootDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if skipWatchDir(rootDir, path, d) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !watchable(path) {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			stamps[path] = fileStamp{info.ModTime(), info.Size()}
+		}
+		return nil
+	})
+	return stamps
+}
+
+func watchPoll(ctx context.Context, rootDir string, interval time.Duration, changes chan<- string) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		last := scanTree(rootDir)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			current := scanTree(rootDir)
+			var changed []string
+			for path, stamp := range current {
+				if last[path] != stamp {
+					changed = append(changed, path)
+				}
+			}
+			for path := range last {
+				if _, ok := current[path]; !ok {
+					changed = append(changed, path)
+				}
+			}
+			last = current
+			for _, path := range changed {
+				select {
+				case changes <- path:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return cancel
+}
+
+// onChange is called with the changed files once no change was seen for the delay,
+// and watch returns when ctx is done
+func watch(ctx context.Context, cfg *lib.Config, delay time.Duration, onChange func(ctx context.Context, files []string)) error {
+	rootDir, err := filepath.Abs(cfg.RootDir)
+	if err != nil {
+		return fmt.Errorf("filepath.Abs() failed: %w", err)
+	}
+	changes := make(chan string)
+	stop, err := watchNotify(ctx, rootDir, changes)
+	if err != nil {
+		// e.g. the limit of inotify watches is reached
+		cfg.Logf("file notification unavailable (%v), polling for changes", err)
+		stop = watchPoll(ctx, rootDir, time.Second, changes)
+	}
+	defer stop()
+
+	pending := make(map[string]bool)
+	timer := time.NewTimer(delay)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case path := <-changes:
+			pending[path] = true
+			timer.Reset(delay)
+		case <-timer.C:
+			var files []string
+			for path := range pending {
+				files = append(files, path)
+			}
+			slices.Sort(files)
+			clear(pending)
+			onChange(ctx, files)
+		}
+	}
+}
+
+// changedPackages returns the directories of the changed files covered by the patterns of cfg,
+// and the patterns of those still existing. It is not ok if a pattern is not relative to the
+// root directory, as such patterns cannot be matched without loading the packages.
+func changedPackages(cfg *lib.Config, files []string) (dirs map[string]bool, patterns []string, ok bool) {
+	rootDir, err := filepath.Abs(cfg.RootDir)
+	if err != nil {
+		return nil, nil, false
+	}
+	cfgPatterns := cfg.Patterns
+	if len(cfgPatterns) <= 0 {
+		cfgPatterns = []string{"./..."}
+	}
+	for _, p := range cfgPatterns {
+		if p != "." && !strings.HasPrefix(p, "./") {
+			return nil, nil, false
+		}
+	}
+	covered := func(rel string) bool {
+		for _, p := range cfgPatterns {
+			if base, found := strings.CutSuffix(p, "/..."); found {
+				base = path.Clean(base)
+				if base == "." || rel == base || strings.HasPrefix(rel, base+"/") {
+					return true
+				}
+			} else if rel == path.Clean(p) {
+				return true
+			}
+		}
+		return false
+	}
+
+	dirs = make(map[string]bool)
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		rel, err := filepath.Rel(rootDir, dir)
+		if err != nil || !covered(filepath.ToSlash(rel)) || dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			patterns = append(patterns, "./"+filepath.ToSlash(rel))
+		}
+	}
+	slices.Sort(patterns)
+	return dirs, patterns, true
+}
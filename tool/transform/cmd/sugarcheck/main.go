@@ -0,0 +1,11 @@
+package main
+
+import (
+	"golang.org/x/tools/go/analysis/singlechecker"
+
+	"github.com/arcane-craft/sugar/tool/transform/analyzer"
+)
+
+func main() {
+	singlechecker.Main(analyzer.Analyzer)
+}
@@ -7,7 +7,6 @@ import (
 	"go/token"
 	"go/types"
 	"io"
-	"os"
 	"path"
 	"slices"
 	"strings"
@@ -16,10 +15,13 @@ import (
 	"golang.org/x/tools/go/packages"
 )
 
+const SyntaxName = "exception"
+
 const (
 	errorTypeName        = "error"
 	stdErrorsPkgPath     = "errors"
 	exceptionPkgPath     = "github.com/arcane-craft/sugar/syntax/exception"
+	tryFuncPkgPath       = "github.com/arcane-craft/sugar/syntax/tryfunc"
 	tryFunName           = "Try"
 	catchFunName         = "Catch"
 	catchTargetErrorName = "Error"
@@ -30,13 +32,50 @@ const (
 )
 
 type ExceptionSyntaxInspector struct {
-	pkg *packages.Package
+	pkg          *packages.Package
+	tryFuncCalls map[string]int
+	diagnostics  lib.DiagnosticSet
 }
 
 func NewExceptionSyntaxInspector(pkg *packages.Package) *ExceptionSyntaxInspector {
+	tryFuncCalls := make(map[string]int)
+	for ident, object := range pkg.TypesInfo.Uses {
+		if _, ok := object.(*types.Func); ok && object.Pkg() != nil && object.Pkg().Path() == tryFuncPkgPath {
+			tryFuncCalls[pkg.Fset.PositionFor(ident.Pos(), false).Filename]++
+		}
+	}
 	return &ExceptionSyntaxInspector{
-		pkg: pkg,
+		pkg:          pkg,
+		tryFuncCalls: tryFuncCalls,
+	}
+}
+
+// BlockLiterals returns the function literals passed to Try, Catch and Finally in pkg. They are
+// inlined into the enclosing function when the syntax is lowered, so the other syntaxes used in
+// them follow the enclosing function.
+func BlockLiterals(pkg *packages.Package) map[*ast.FuncLit]bool {
+	blocks := make(map[*ast.FuncLit]bool)
+	if pkg.TypesInfo == nil {
+		return blocks
+	}
+	for _, file := range pkg.Syntax {
+		ast.Inspect(file, func(n ast.Node) bool {
+			callExpr, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			switch exceptionFuncName(pkg.TypesInfo, callExpr) {
+			case tryFunName, catchFunName, finallyFunName:
+				for _, arg := range callExpr.Args {
+					if lit, ok := arg.(*ast.FuncLit); ok {
+						blocks[lit] = true
+					}
+				}
+			}
+			return true
+		})
 	}
+	return blocks
 }
 
 func (i *ExceptionSyntaxInspector) Nodes() []ast.Node {
@@ -57,6 +96,8 @@ type Func struct {
 	AssignToken string
 	Vars        []*lib.Extent
 	OuterStmt   *lib.Extent
+	// the call is the argument of a Try() of the tryfunc syntax
+	TryFunc bool
 }
 
 func (m *Func) Start() token.Position {
@@ -71,8 +112,8 @@ func (m *Func) String() string {
 	if m == nil {
 		return "<nil>"
 	}
-	return fmt.Sprintf("%s, Expr: %s, Vars: [%s], OuterStmt: %s",
-		m.Extent, m.Expr, lib.JoinStringers(m.Vars, ";"), m.OuterStmt)
+	return fmt.Sprintf("%s, Expr: %s, Vars: [%s], OuterStmt: %s, TryFunc: %t",
+		m.Extent, m.Expr, lib.JoinStringers(m.Vars, ";"), m.OuterStmt, m.TryFunc)
 }
 
 type Return struct {
@@ -238,6 +279,8 @@ type ExceptionSyntax struct {
 	Blocks     []SyntaxBlock
 	HasCatch   bool
 	HasFinally bool
+	// calls of the tryfunc syntax in the file, its import is dropped once all of them are lowered
+	TryFuncCalls int
 }
 
 func (m *ExceptionSyntax) String() string {
@@ -280,37 +323,74 @@ func (i *ExceptionSyntaxInspector) inspectSyntaxBody(body *ast.BlockStmt) (calls
 	return
 }
 
-func (i *ExceptionSyntaxInspector) inspectTryBlock(node ast.Expr) (ret *Try) {
-	callExpr, ok := node.(*ast.CallExpr)
-	if ok && len(callExpr.Args) == 1 {
-		var object types.Object
-		switch fun := callExpr.Fun.(type) {
-		case *ast.SelectorExpr:
-			object = i.pkg.TypesInfo.ObjectOf(fun.Sel)
-		case *ast.Ident:
-			object = i.pkg.TypesInfo.ObjectOf(fun)
+func (i *ExceptionSyntaxInspector) exceptionFuncName(callExpr *ast.CallExpr) string {
+	return exceptionFuncName(i.pkg.TypesInfo, callExpr)
+}
+
+func exceptionFuncName(info *types.Info, callExpr *ast.CallExpr) string {
+	return pkgFuncName(info, callExpr.Fun, exceptionPkgPath)
+}
+
+func pkgFuncName(info *types.Info, fun ast.Expr, pkgPath string) string {
+	var ident *ast.Ident
+	switch fun := fun.(type) {
+	case *ast.SelectorExpr:
+		ident = fun.Sel
+	case *ast.Ident:
+		ident = fun
+	}
+	if ident != nil {
+		object := info.ObjectOf(ident)
+		if object != nil && object.Pkg() != nil && object.Pkg().Path() == pkgPath {
+			return object.Name()
 		}
-		if object != nil && object.Pkg() != nil &&
-			object.Pkg().Path() == exceptionPkgPath &&
-			object.Name() == tryFunName {
+	}
+	return ""
+}
 
-			funcLit, ok := callExpr.Args[0].(*ast.FuncLit)
-			if ok && funcLit.Body != nil {
-				calls := i.inspectSyntaxBody(funcLit.Body)
-				if len(calls) > 0 {
-					ret = &Try{
-						Extent: lib.Extent{
-							Start: i.pkg.Fset.Position(callExpr.Pos()),
-							End:   i.pkg.Fset.Position(callExpr.End()),
-						},
-						Body: &lib.Extent{
-							Start: i.pkg.Fset.Position(funcLit.Body.Pos() + 1),
-							End:   i.pkg.Fset.Position(funcLit.Body.End() - 1),
-						},
-						Calls: calls,
-					}
-				}
-			}
+// the call wrapped in a Try() of the tryfunc syntax raises its error like a call assigning it to _
+func (i *ExceptionSyntaxInspector) unwrapTryFunc(expr ast.Expr) (ast.Expr, bool) {
+	callExpr, ok := expr.(*ast.CallExpr)
+	if !ok || len(callExpr.Args) != 1 {
+		return expr, false
+	}
+	fun := callExpr.Fun
+	if index, ok := fun.(*ast.IndexExpr); ok {
+		fun = index.X
+	}
+	if len(pkgFuncName(i.pkg.TypesInfo, fun, tryFuncPkgPath)) <= 0 {
+		return expr, false
+	}
+	if _, ok := callExpr.Args[0].(*ast.CallExpr); !ok {
+		return expr, false
+	}
+	return callExpr.Args[0], true
+}
+
+func (i *ExceptionSyntaxInspector) inspectTryBlock(node ast.Expr) (ret *Try, diag *lib.Diagnostic) {
+	callExpr, ok := node.(*ast.CallExpr)
+	if ok && len(callExpr.Args) == 1 && i.exceptionFuncName(callExpr) == tryFunName {
+		funcLit, ok := callExpr.Args[0].(*ast.FuncLit)
+		if !ok || funcLit.Body == nil {
+			diag = i.newDiagnostic(callExpr.Pos(), fmt.Sprintf("%s() requires a function literal argument", tryFunName))
+			return
+		}
+		calls := i.inspectSyntaxBody(funcLit.Body)
+		if len(calls) <= 0 {
+			diag = i.newDiagnostic(callExpr.Pos(), fmt.Sprintf("%s() block must contain at least one error-returning call, %s() or %s()",
+				tryFunName, returnFunName, throwFunName))
+			return
+		}
+		ret = &Try{
+			Extent: lib.Extent{
+				Start: i.pkg.Fset.Position(callExpr.Pos()),
+				End:   i.pkg.Fset.Position(callExpr.End()),
+			},
+			Body: &lib.Extent{
+				Start: i.pkg.Fset.Position(funcLit.Body.Pos() + 1),
+				End:   i.pkg.Fset.Position(funcLit.Body.End() - 1),
+			},
+			Calls: calls,
 		}
 	}
 	return
@@ -367,76 +447,76 @@ func (i *ExceptionSyntaxInspector) queryCatchTarget(node ast.Expr) (typ int, tar
 	return
 }
 
-func (i *ExceptionSyntaxInspector) inspectCatchBlock(node ast.Expr) (ret *Catch) {
+func (i *ExceptionSyntaxInspector) inspectCatchBlock(node ast.Expr) (ret *Catch, diag *lib.Diagnostic) {
 	callExpr, ok := node.(*ast.CallExpr)
 	if ok && len(callExpr.Args) == 2 {
 		fun, ok := callExpr.Fun.(*ast.SelectorExpr)
-		if ok {
-			object := i.pkg.TypesInfo.ObjectOf(fun.Sel)
-			if object != nil && object.Pkg() != nil &&
-				object.Pkg().Path() == exceptionPkgPath &&
-				object.Name() == catchFunName {
-				catchType, targets, ok := i.queryCatchTarget(callExpr.Args[0])
-				if ok {
-					funcLit, ok := callExpr.Args[1].(*ast.FuncLit)
-					if ok && funcLit.Type.Params != nil && funcLit.Type.Params.NumFields() == 1 {
-						var errVar string
-						if len(funcLit.Type.Params.List[0].Names) > 0 {
-							errVar = funcLit.Type.Params.List[0].Names[0].Name
-						}
-						if funcLit.Body != nil {
-							calls := i.inspectSyntaxBody(funcLit.Body)
-							if len(calls) > 0 {
-								ret = &Catch{
-									Extent: lib.Extent{
-										Start: i.pkg.Fset.Position(fun.Sel.Pos() - 1),
-										End:   i.pkg.Fset.Position(callExpr.End()),
-									},
-									Body: &lib.Extent{
-										Start: i.pkg.Fset.Position(funcLit.Body.Pos() + 1),
-										End:   i.pkg.Fset.Position(funcLit.Body.End() - 1),
-									},
-									Type:    catchType,
-									Targets: targets,
-									Err:     errVar,
-									Calls:   calls,
-								}
-							}
-						}
-					}
+		if ok && i.exceptionFuncName(callExpr) == catchFunName {
+			catchType, targets, ok := i.queryCatchTarget(callExpr.Args[0])
+			if !ok {
+				diag = i.newDiagnostic(fun.Sel.Pos(), fmt.Sprintf("%s() requires %s(...) or %s[...]() as its target",
+					catchFunName, catchTargetErrorName, catchTargetTypeName))
+				return
+			}
+			funcLit, ok := callExpr.Args[1].(*ast.FuncLit)
+			if !ok || funcLit.Body == nil {
+				diag = i.newDiagnostic(fun.Sel.Pos(), fmt.Sprintf("%s() requires a function literal handler", catchFunName))
+				if !ok {
+					diag.Fixes = append(diag.Fixes, i.newWrapHandlerFix(callExpr.Args[1],
+						[]*ast.Field{{Names: []*ast.Ident{ast.NewIdent("err")}, Type: ast.NewIdent(errorTypeName)}}, lib.Idents("err")))
 				}
+				return
+			}
+			if funcLit.Type.Params == nil || funcLit.Type.Params.NumFields() != 1 {
+				diag = i.newDiagnostic(fun.Sel.Pos(), fmt.Sprintf("%s() handler must take exactly one error parameter", catchFunName))
+				return
+			}
+			var errVar string
+			if names := funcLit.Type.Params.List[0].Names; len(names) > 0 && i.isUsed(names[0], funcLit.Body) {
+				errVar = names[0].Name
+			}
+			ret = &Catch{
+				Extent: lib.Extent{
+					Start: i.pkg.Fset.Position(fun.Sel.Pos() - 1),
+					End:   i.pkg.Fset.Position(callExpr.End()),
+				},
+				Body: &lib.Extent{
+					Start: i.pkg.Fset.Position(funcLit.Body.Pos() + 1),
+					End:   i.pkg.Fset.Position(funcLit.Body.End() - 1),
+				},
+				Type:    catchType,
+				Targets: targets,
+				Err:     errVar,
+				Calls:   i.inspectSyntaxBody(funcLit.Body),
 			}
 		}
 	}
 	return
 }
 
-func (i *ExceptionSyntaxInspector) inspectFinallyBlock(node ast.Expr) (ret *Finally) {
+func (i *ExceptionSyntaxInspector) inspectFinallyBlock(node ast.Expr) (ret *Finally, diag *lib.Diagnostic) {
 	callExpr, ok := node.(*ast.CallExpr)
 	if ok && len(callExpr.Args) == 1 {
 		fun, ok := callExpr.Fun.(*ast.SelectorExpr)
-		if ok {
-			object := i.pkg.TypesInfo.ObjectOf(fun.Sel)
-			if object != nil && object.Pkg() != nil &&
-				object.Pkg().Path() == exceptionPkgPath &&
-				object.Name() == finallyFunName {
-				funcLit, ok := callExpr.Args[0].(*ast.FuncLit)
-				if ok && funcLit.Body != nil {
-					calls := i.inspectSyntaxBody(funcLit.Body)
-					if len(calls) > 0 {
-						ret = &Finally{
-							Extent: lib.Extent{
-								Start: i.pkg.Fset.Position(fun.Sel.Pos() - 1),
-								End:   i.pkg.Fset.Position(callExpr.End()),
-							},
-							Body: &lib.Extent{
-								Start: i.pkg.Fset.Position(funcLit.Body.Pos() + 1),
-								End:   i.pkg.Fset.Position(funcLit.Body.End() - 1),
-							},
-							Calls: calls,
-						}
-					}
+		if ok && i.exceptionFuncName(callExpr) == finallyFunName {
+			funcLit, ok := callExpr.Args[0].(*ast.FuncLit)
+			if !ok || funcLit.Body == nil {
+				diag = i.newDiagnostic(fun.Sel.Pos(), fmt.Sprintf("%s() requires a function literal argument", finallyFunName))
+				if !ok {
+					diag.Fixes = append(diag.Fixes, i.newWrapHandlerFix(callExpr.Args[0], nil, nil))
 				}
+				return
+			}
+			ret = &Finally{
+				Extent: lib.Extent{
+					Start: i.pkg.Fset.Position(fun.Sel.Pos() - 1),
+					End:   i.pkg.Fset.Position(callExpr.End()),
+				},
+				Body: &lib.Extent{
+					Start: i.pkg.Fset.Position(funcLit.Body.Pos() + 1),
+					End:   i.pkg.Fset.Position(funcLit.Body.End() - 1),
+				},
+				Calls: i.inspectSyntaxBody(funcLit.Body),
 			}
 		}
 	}
@@ -453,8 +533,8 @@ func (i *ExceptionSyntaxInspector) findFuncRetType(node ast.Node) (ret []*lib.Ex
 	default:
 		return
 	}
+	finish = true
 	if resultTypes != nil {
-		finish = true
 		if resultTypes.NumFields() > 0 {
 			ident, ok := resultTypes.List[len(resultTypes.List)-1].Type.(*ast.Ident)
 			if ok && ident.Name == errorTypeName {
@@ -470,6 +550,18 @@ func (i *ExceptionSyntaxInspector) findFuncRetType(node ast.Node) (ret []*lib.Ex
 	return
 }
 
+// the parameter becomes a variable once the body is inlined, which must not be left unused
+func (i *ExceptionSyntaxInspector) isUsed(param *ast.Ident, body *ast.BlockStmt) (used bool) {
+	object := i.pkg.TypesInfo.Defs[param]
+	ast.Inspect(body, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && object != nil && i.pkg.TypesInfo.Uses[ident] == object {
+			used = true
+		}
+		return !used
+	})
+	return
+}
+
 func (i *ExceptionSyntaxInspector) queryCallStmtRetType(node ast.Expr) (num *int) {
 	call, ok := node.(*ast.CallExpr)
 	if !ok {
@@ -494,7 +586,8 @@ func (i *ExceptionSyntaxInspector) queryCallStmtRetType(node ast.Expr) (num *int
 func (i *ExceptionSyntaxInspector) findCallStmt(node ast.Stmt, outer ast.Stmt) (ret *Func) {
 	switch stmt := node.(type) {
 	case *ast.ExprStmt:
-		retNum := i.queryCallStmtRetType(stmt.X)
+		expr, tryFunc := i.unwrapTryFunc(stmt.X)
+		retNum := i.queryCallStmtRetType(expr)
 		if retNum != nil {
 			ret = &Func{
 				Extent: lib.Extent{
@@ -502,48 +595,63 @@ func (i *ExceptionSyntaxInspector) findCallStmt(node ast.Stmt, outer ast.Stmt) (
 					End:   i.pkg.Fset.Position(stmt.End()),
 				},
 				Expr: &lib.Extent{
-					Start: i.pkg.Fset.Position(stmt.X.Pos()),
-					End:   i.pkg.Fset.Position(stmt.X.End()),
+					Start: i.pkg.Fset.Position(expr.Pos()),
+					End:   i.pkg.Fset.Position(expr.End()),
 				},
+				TryFunc: tryFunc,
 			}
 			for idx := 0; idx < *retNum; idx++ {
 				ret.Vars = append(ret.Vars, &lib.Extent{
-					Start: i.pkg.Fset.Position(stmt.X.Pos() + token.Pos(idx)),
-					End:   i.pkg.Fset.Position(stmt.X.End()),
+					Start: i.pkg.Fset.Position(expr.Pos() + token.Pos(idx)),
+					End:   i.pkg.Fset.Position(expr.End()),
 				})
 			}
 		}
 	case *ast.AssignStmt:
 		if len(stmt.Rhs) == 1 {
-			retNum := i.queryCallStmtRetType(stmt.Rhs[0])
+			callExpr, tryFunc := i.unwrapTryFunc(stmt.Rhs[0])
+			retNum := i.queryCallStmtRetType(callExpr)
+			// the error is assigned to _, or left implicit by Try()
+			var matched bool
 			if retNum != nil {
-				if ident, ok := stmt.Lhs[len(stmt.Lhs)-1].(*ast.Ident); ok && ident.Name == "_" {
-					callExpr := stmt.Rhs[0]
-					ret = &Func{
-						Extent: lib.Extent{
-							Start: i.pkg.Fset.Position(stmt.Pos()),
-							End:   i.pkg.Fset.Position(stmt.End()),
-						},
-						Expr: &lib.Extent{
-							Start: i.pkg.Fset.Position(callExpr.Pos()),
-							End:   i.pkg.Fset.Position(callExpr.End()),
-						},
-					}
-					if *retNum > 1 {
-						ret.AssignToken = stmt.Tok.String()
-					}
-					for idx := 0; idx < len(stmt.Lhs); idx++ {
-						ret.Vars = append(ret.Vars, &lib.Extent{
-							Start: i.pkg.Fset.Position(stmt.Lhs[idx].Pos()),
-							End:   i.pkg.Fset.Position(stmt.Lhs[idx].End()),
-						})
-					}
+				if tryFunc {
+					matched = len(stmt.Lhs)+1 == *retNum
+				} else if ident, ok := stmt.Lhs[len(stmt.Lhs)-1].(*ast.Ident); ok && ident.Name == "_" {
+					matched = true
+				}
+			}
+			if matched {
+				ret = &Func{
+					Extent: lib.Extent{
+						Start: i.pkg.Fset.Position(stmt.Pos()),
+						End:   i.pkg.Fset.Position(stmt.End()),
+					},
+					Expr: &lib.Extent{
+						Start: i.pkg.Fset.Position(callExpr.Pos()),
+						End:   i.pkg.Fset.Position(callExpr.End()),
+					},
+					TryFunc: tryFunc,
+				}
+				if *retNum > 1 {
+					ret.AssignToken = stmt.Tok.String()
+				}
+				for idx := 0; idx < len(stmt.Lhs); idx++ {
+					ret.Vars = append(ret.Vars, &lib.Extent{
+						Start: i.pkg.Fset.Position(stmt.Lhs[idx].Pos()),
+						End:   i.pkg.Fset.Position(stmt.Lhs[idx].End()),
+					})
+				}
+				if tryFunc {
+					ret.Vars = append(ret.Vars, &lib.Extent{
+						Start: i.pkg.Fset.Position(stmt.Rhs[0].Pos()),
+						End:   i.pkg.Fset.Position(stmt.Rhs[0].End()),
+					})
 				}
 			}
 		}
 	}
 
-	if outer != nil {
+	if ret != nil && outer != nil {
 		var hasOuterStmt bool
 		switch parent := outer.(type) {
 		case *ast.IfStmt:
@@ -629,49 +737,102 @@ func (i *ExceptionSyntaxInspector) findReturnStmt(node ast.Stmt) (ret *Return) {
 	return
 }
 
+func (i *ExceptionSyntaxInspector) newDiagnostic(pos token.Pos, reason string) *lib.Diagnostic {
+	return &lib.Diagnostic{
+		Pos:    i.pkg.Fset.Position(pos),
+		Syntax: SyntaxName,
+		Reason: reason,
+	}
+}
+
+func (i *ExceptionSyntaxInspector) newWrapHandlerFix(handler ast.Expr, params []*ast.Field, args []ast.Expr) *lib.Fix {
+	fix := &lib.Fix{Message: "Wrap the handler in a function literal"}
+	lit := &ast.FuncLit{
+		Type: &ast.FuncType{Params: &ast.FieldList{List: params}},
+		Body: GenBlock([]ast.Stmt{&ast.ExprStmt{X: &ast.CallExpr{Fun: handler, Args: args}}}),
+	}
+	text, err := lib.FormatNode(i.pkg.Fset, lit)
+	if err != nil {
+		return fix
+	}
+	fix.Edits = append(fix.Edits, &lib.TextEdit{
+		Old: lib.Extent{
+			Start: i.pkg.Fset.Position(handler.Pos()),
+			End:   i.pkg.Fset.Position(handler.End()),
+		},
+		New: text,
+	})
+	return fix
+}
+
+func (i *ExceptionSyntaxInspector) report(pos token.Pos, reason string) {
+	i.diagnostics.Add(i.newDiagnostic(pos, reason))
+}
+
+func (i *ExceptionSyntaxInspector) Diagnostics() lib.Diagnostics {
+	return i.diagnostics.Diagnostics()
+}
+
 func (i *ExceptionSyntaxInspector) Inspect(node ast.Node, stack []ast.Node) (syntax *ExceptionSyntax) {
 	exprStmt := node.(*ast.ExprStmt)
 	callExpr, ok := exprStmt.X.(*ast.CallExpr)
 	if !ok {
 		return
 	}
+	switch name := i.exceptionFuncName(callExpr); name {
+	case tryFunName, catchFunName, finallyFunName:
+	case returnFunName, throwFunName:
+		i.report(callExpr.Pos(), fmt.Sprintf("%s() must be used inside a %s, %s or %s block",
+			name, tryFunName, catchFunName, finallyFunName))
+		return
+	default:
+		return
+	}
 
 	var blocks []SyntaxBlock
 	var hasCatch, hasFinally bool
-	finallyBlock := i.inspectFinallyBlock(callExpr)
+	finallyBlock, diag := i.inspectFinallyBlock(callExpr)
+	if diag != nil {
+		i.diagnostics.Add(diag)
+		return
+	}
 	if finallyBlock != nil {
-		sel, ok := callExpr.Fun.(*ast.SelectorExpr)
-		if !ok {
-			return
-		}
-		callExpr, ok = sel.X.(*ast.CallExpr)
+		callExpr, ok = callExpr.Fun.(*ast.SelectorExpr).X.(*ast.CallExpr)
 		if !ok {
+			i.report(exprStmt.Pos(), fmt.Sprintf("%s() must be chained on %s(...)", finallyFunName, tryFunName))
 			return
 		}
 		blocks = append(blocks, finallyBlock)
 		hasFinally = true
 	}
-	for catch := i.inspectCatchBlock(callExpr); catch != nil; catch = i.inspectCatchBlock(callExpr) {
-		sel, ok := callExpr.Fun.(*ast.SelectorExpr)
-		if !ok {
+	for {
+		catch, diag := i.inspectCatchBlock(callExpr)
+		if diag != nil {
+			i.diagnostics.Add(diag)
 			return
 		}
-		callExpr, ok = sel.X.(*ast.CallExpr)
+		if catch == nil {
+			break
+		}
+		callExpr, ok = callExpr.Fun.(*ast.SelectorExpr).X.(*ast.CallExpr)
 		if !ok {
+			i.report(exprStmt.Pos(), fmt.Sprintf("%s() must be chained on %s(...)", catchFunName, tryFunName))
 			return
 		}
 		blocks = append(blocks, catch)
 		hasCatch = true
 	}
-	tryBlock := i.inspectTryBlock(callExpr)
+	tryBlock, diag := i.inspectTryBlock(callExpr)
+	if diag != nil {
+		i.diagnostics.Add(diag)
+		return
+	}
 	if tryBlock == nil {
+		i.report(exprStmt.Pos(), fmt.Sprintf("exception handler chain must start with %s(...)", tryFunName))
 		return
 	}
 	blocks = append(blocks, tryBlock)
 
-	if len(stack) < 2 {
-		return
-	}
 	var outerFuncRetTypes []*lib.Extent
 	for idx := len(stack) - 2; idx >= 0; idx-- {
 		node := stack[idx]
@@ -679,12 +840,13 @@ func (i *ExceptionSyntaxInspector) Inspect(node ast.Node, stack []ast.Node) (syn
 		if !finish {
 			continue
 		}
-		if len(retTypes) <= 0 {
-			return
-		}
 		outerFuncRetTypes = retTypes
 		break
 	}
+	if len(outerFuncRetTypes) <= 0 {
+		i.report(callExpr.Pos(), fmt.Sprintf("%s() requires the enclosing function to have error as its last result", tryFunName))
+		return
+	}
 
 	slices.Reverse(blocks)
 	syntax = &ExceptionSyntax{
@@ -692,72 +854,97 @@ func (i *ExceptionSyntaxInspector) Inspect(node ast.Node, stack []ast.Node) (syn
 			Start: i.pkg.Fset.Position(exprStmt.Pos()),
 			End:   i.pkg.Fset.Position(exprStmt.End()),
 		},
-		RetTypes:   outerFuncRetTypes,
-		Blocks:     blocks,
-		HasCatch:   hasCatch,
-		HasFinally: hasFinally,
+		RetTypes:     outerFuncRetTypes,
+		Blocks:       blocks,
+		HasCatch:     hasCatch,
+		HasFinally:   hasFinally,
+		TryFuncCalls: i.tryFuncCalls[i.pkg.Fset.PositionFor(exprStmt.Pos(), false).Filename],
 	}
 	return
 }
 
-func GenBlock(stmts []string) string {
-	return fmt.Sprintf("{\n%s\n}", strings.Join(stmts, "\n"))
+func GenBlock(stmts []ast.Stmt) *ast.BlockStmt {
+	return &ast.BlockStmt{List: stmts}
 }
 
-func GenVarDecl(name string, typ string) string {
-	return fmt.Sprintf("var %s %s", name, typ)
+func GenVarDecl(name string, typ ast.Expr) ast.Stmt {
+	return &ast.DeclStmt{Decl: &ast.GenDecl{
+		Tok:   token.VAR,
+		Specs: []ast.Spec{&ast.ValueSpec{Names: []*ast.Ident{ast.NewIdent(name)}, Type: typ}},
+	}}
 }
 
-func GenAssignCall(lhs []string, token string, rhs string) string {
-	return fmt.Sprintf("%s %s %s", strings.Join(lhs, ", "), token, rhs)
+func GenAssignCall(lhs []ast.Expr, tok token.Token, rhs ast.Expr) ast.Stmt {
+	return &ast.AssignStmt{Lhs: lhs, Tok: tok, Rhs: []ast.Expr{rhs}}
 }
 
-func GenErrHandler(errVar string, stmts []string) string {
-	return fmt.Sprintf("if %s != nil {\n%s\n}", errVar, strings.Join(stmts, "\n"))
+func GenErrHandler(errVar string, stmts []ast.Stmt) ast.Stmt {
+	return GenIfStmt(GenCompareExpr(ast.NewIdent(errVar), token.NEQ, ast.NewIdent("nil")), stmts)
 }
 
-func GenErrIsHandler(errorsPkg, errVar string, errVals []string, stmts []string) string {
-	var checks []string
+func GenErrIsHandler(errorsPkg, errVar string, errVals []ast.Expr, stmts []ast.Stmt) ast.Stmt {
+	var checks []ast.Expr
 	for _, e := range errVals {
-		checks = append(checks, fmt.Sprintf("%sIs(%s, %s)", errorsPkg, errVar, e))
+		checks = append(checks, &ast.CallExpr{Fun: lib.QualifiedIdent(errorsPkg, "Is"), Args: []ast.Expr{ast.NewIdent(errVar), e}})
 	}
-	return fmt.Sprintf("if %s {\n%s\n}", strings.Join(checks, " || "), strings.Join(stmts, "\n"))
+	return GenIfStmt(GenOrExpr(checks...), stmts)
 }
 
-func GenErrAsHandler(errorsPkg, errVar string, errTypes []string, stmts []string) string {
-	var checks []string
+func GenErrAsHandler(errorsPkg, errVar string, errTypes []ast.Expr, stmts []ast.Stmt) ast.Stmt {
+	var checks []ast.Expr
 	for _, t := range errTypes {
-		checks = append(checks, fmt.Sprintf("%sAs(%s, %s)", errorsPkg, errVar, t))
+		checks = append(checks, &ast.CallExpr{Fun: lib.QualifiedIdent(errorsPkg, "As"), Args: []ast.Expr{
+			ast.NewIdent(errVar),
+			&ast.CallExpr{Fun: ast.NewIdent("new"), Args: []ast.Expr{t}},
+		}})
 	}
-	return fmt.Sprintf("if %s {\n%s\n}", strings.Join(checks, " || "), strings.Join(stmts, "\n"))
+	return GenIfStmt(GenOrExpr(checks...), stmts)
 }
 
-func GenAssigneStmt(lhs []string, token string, rhs []string) string {
-	return fmt.Sprintf("%s %s %s", strings.Join(lhs, ", "), token, strings.Join(rhs, ", "))
+func GenAssigneStmt(lhs []ast.Expr, tok token.Token, rhs []ast.Expr) ast.Stmt {
+	return &ast.AssignStmt{Lhs: lhs, Tok: tok, Rhs: rhs}
 }
 
-func GenGotoStmt(label string) string {
-	return fmt.Sprintf("goto %s", label)
+func GenGotoStmt(label string) ast.Stmt {
+	return &ast.BranchStmt{Tok: token.GOTO, Label: ast.NewIdent(label)}
 }
 
-func GenLabelDecl(name string) string {
-	return name + ":"
+// a block ending with Return() or Throw() already jumps away
+func appendGoto(stmts []ast.Stmt, label string) []ast.Stmt {
+	if len(stmts) > 0 {
+		switch stmts[len(stmts)-1].(type) {
+		case *ast.BranchStmt, *ast.ReturnStmt:
+			return stmts
+		}
+	}
+	return append(stmts, GenGotoStmt(label))
 }
 
-func GenReturns(exprs []string) string {
-	return fmt.Sprintf("return %s", strings.Join(exprs, ", "))
+func GenLabelDecl(name string, stmt ast.Stmt) ast.Stmt {
+	if len(name) <= 0 {
+		return stmt
+	}
+	return &ast.LabeledStmt{Label: ast.NewIdent(name), Stmt: stmt}
+}
+
+func GenReturns(exprs []ast.Expr) ast.Stmt {
+	return &ast.ReturnStmt{Results: exprs}
 }
 
-func GenOrExpr(predicates ...string) string {
-	return strings.Join(predicates, " || ")
+func GenOrExpr(predicates ...ast.Expr) ast.Expr {
+	expr := predicates[0]
+	for _, p := range predicates[1:] {
+		expr = &ast.BinaryExpr{X: expr, Op: token.LOR, Y: p}
+	}
+	return expr
 }
 
-func GenCompareExpr(left string, op string, right string) string {
-	return fmt.Sprintf("%s %s %s", left, op, right)
+func GenCompareExpr(left ast.Expr, op token.Token, right ast.Expr) ast.Expr {
+	return &ast.BinaryExpr{X: left, Op: op, Y: right}
 }
 
-func GenIfStmt(cond string, stmt []string) string {
-	return fmt.Sprintf("if %s {\n %s \n}", cond, strings.Join(stmt, "\n"))
+func GenIfStmt(cond ast.Expr, stmts []ast.Stmt) ast.Stmt {
+	return &ast.IfStmt{Cond: cond, Body: GenBlock(stmts)}
 }
 
 type Translator struct{}
@@ -770,332 +957,362 @@ func (*Translator) InspectSyntax(p *packages.Package, _ []*lib.Extent) lib.Synta
 	return NewExceptionSyntaxInspector(p)
 }
 
-func genFuncStmt(file *os.File, call *Func, catchErrVar, gotoLabel string) ([]string, error) {
-	var stmts []string
+func genFuncStmt(src *lib.Source, call *Func, catchErrVar, gotoLabel string) ([]ast.Stmt, error) {
+	var stmts []ast.Stmt
 
-	expr, err := lib.ReadExtent(file, call.Expr)
+	expr, err := src.Expr(call.Expr)
 	if err != nil {
-		return nil, fmt.Errorf("lib.ReadExtent() failed: %w", err)
+		return nil, fmt.Errorf("src.Expr() failed: %w", err)
 	}
-	var vars []string
+	var vars []ast.Expr
 	if len(call.AssignToken) > 0 {
-		vars, err = lib.ReadExtentList(file, call.Vars[:len(call.Vars)-1])
+		vars, err = src.Exprs(call.Vars[:len(call.Vars)-1])
 		if err != nil {
-			return nil, fmt.Errorf("lib.ReadExtent() failed: %w", err)
+			return nil, fmt.Errorf("src.Exprs() failed: %w", err)
 		}
 	} else {
 		for range call.Vars[:len(call.Vars)-1] {
-			vars = append(vars, "_")
+			vars = append(vars, ast.NewIdent("_"))
 		}
 	}
 	errVar := lib.GenVarName("err", call.Vars[len(call.Vars)-1].String())
-	if call.AssignToken == ":=" {
-		stmts = append(stmts, GenAssignCall(append(vars, errVar), call.AssignToken, expr))
-	} else if call.AssignToken == "=" {
-		stmts = append(stmts, GenVarDecl(errVar, errorTypeName))
-		stmts = append(stmts, GenAssignCall(append(vars, errVar), call.AssignToken, expr))
+	lhs := append(vars, ast.NewIdent(errVar))
+	if call.AssignToken == token.ASSIGN.String() {
+		stmts = append(stmts, GenVarDecl(errVar, ast.NewIdent(errorTypeName)))
+		stmts = append(stmts, GenAssignCall(lhs, token.ASSIGN, expr))
 	} else {
-		stmts = append(stmts, GenAssignCall(append(vars, errVar), ":=", expr))
+		stmts = append(stmts, GenAssignCall(lhs, token.DEFINE, expr))
 	}
-	stmts = append(stmts, GenErrHandler(errVar, []string{
-		GenAssigneStmt([]string{catchErrVar}, "=", []string{errVar}),
+	stmts = append(stmts, GenErrHandler(errVar, []ast.Stmt{
+		GenAssigneStmt(lib.Idents(catchErrVar), token.ASSIGN, lib.Idents(errVar)),
 		GenGotoStmt(gotoLabel),
 	}))
 
 	return stmts, nil
 }
 
-func genThrowStmt(file *os.File, call *Throw, catchErrVar, gotoLabel string) ([]string, error) {
-	var stmts []string
-
-	errExpr, err := lib.ReadExtent(file, call.Err)
+func genThrowStmt(src *lib.Source, call *Throw, catchErrVar, gotoLabel string) ([]ast.Stmt, error) {
+	errExpr, err := src.Expr(call.Err)
 	if err != nil {
-		return nil, fmt.Errorf("lib.ReadExtent() failed: %w", err)
+		return nil, fmt.Errorf("src.Expr() failed: %w", err)
 	}
-	stmts = append(stmts, GenAssigneStmt([]string{catchErrVar}, "=", []string{errExpr}))
-	stmts = append(stmts, GenGotoStmt(gotoLabel))
+	return []ast.Stmt{
+		GenAssigneStmt(lib.Idents(catchErrVar), token.ASSIGN, []ast.Expr{errExpr}),
+		GenGotoStmt(gotoLabel),
+	}, nil
+}
 
-	return stmts, nil
+func genFinallyThrowStmt(src *lib.Source, call *Throw, hasReturnVar, catchErrVar, gotoLabel string) ([]ast.Stmt, error) {
+	errExpr, err := src.Expr(call.Err)
+	if err != nil {
+		return nil, fmt.Errorf("src.Expr() failed: %w", err)
+	}
+	return []ast.Stmt{
+		GenAssigneStmt(lib.Idents(catchErrVar), token.ASSIGN, []ast.Expr{errExpr}),
+		GenAssigneStmt(lib.Idents(hasReturnVar), token.ASSIGN, lib.Idents("true")),
+		GenGotoStmt(gotoLabel),
+	}, nil
 }
 
-func genReturnStmt(file *os.File, call *Return, resultVars []string, hasReturnVar, catchErrVar, gotoLabel string) ([]string, error) {
-	var stmts []string
+func genReturnStmt(src *lib.Source, call *Return, resultVars []string, hasReturnVar, catchErrVar, gotoLabel string) ([]ast.Stmt, error) {
+	var stmts []ast.Stmt
 
-	args, err := lib.ReadExtentList(file, call.Args)
+	args, err := src.Exprs(call.Args)
 	if err != nil {
-		return nil, fmt.Errorf("lib.ReadExtentList() failed: %w", err)
+		return nil, fmt.Errorf("src.Exprs() failed: %w", err)
+	}
+	if len(resultVars) > 0 {
+		stmts = append(stmts, GenAssigneStmt(lib.Idents(resultVars...), token.ASSIGN, args))
 	}
-	stmts = append(stmts, GenAssigneStmt(resultVars, "=", args))
 	if len(hasReturnVar) > 0 {
-		stmts = append(stmts, GenAssigneStmt([]string{hasReturnVar}, "=", []string{"true"}))
+		stmts = append(stmts, GenAssigneStmt(lib.Idents(hasReturnVar), token.ASSIGN, lib.Idents("true")))
 		stmts = append(stmts, GenGotoStmt(gotoLabel))
-
 	} else {
-		stmts = append(stmts, GenReturns(append(resultVars, catchErrVar)))
+		stmts = append(stmts, GenReturns(lib.Idents(append(resultVars, catchErrVar)...)))
 	}
 
 	return stmts, nil
 }
 
-func genBlockCalls(file *os.File, block SyntaxBlock, proc func(c CallStmt) ([]string, error)) ([]string, error) {
-	var blockStmts []string
-	gapStart := block.BodyStart()
-	for _, c := range block.CallStmts() {
-		gapExtent := &lib.Extent{
-			Start: gapStart,
-			End:   c.Start(),
-		}
-		if call, ok := c.(*Func); ok && call.OuterStmt != nil {
-			gapExtent.End = call.OuterStmt.Start
-		}
-		gap, err := lib.ReadExtent(file, gapExtent)
-		if err != nil {
-			return nil, fmt.Errorf("lib.ReadExtent() failed: %w", err)
-		}
-		blockStmts = append(blockStmts, gap)
-		gapStart = c.End()
+func stmtNodes(stmts []ast.Stmt) []ast.Node {
+	var ret []ast.Node
+	for _, s := range stmts {
+		ret = append(ret, s)
+	}
+	return ret
+}
 
+// the statements of the block body, with the calls in it replaced by the generated statements
+func genBlockCalls(src *lib.Source, block SyntaxBlock, proc func(c CallStmt) ([]ast.Stmt, error)) ([]ast.Stmt, error) {
+	var blocks []*lib.ReplaceBlock
+	for _, c := range block.CallStmts() {
 		stmts, err := proc(c)
 		if err != nil {
 			return nil, err
 		}
-		blockStmts = append(blockStmts, stmts...)
-
+		callExtent := lib.Extent{Start: c.Start(), End: c.End()}
 		if call, ok := c.(*Func); ok && call.OuterStmt != nil {
-			gapExtent.Start = call.OuterStmt.Start
-			gapExtent.End = call.Start()
-			gap, err := lib.ReadExtent(file, gapExtent)
-			if err != nil {
-				return nil, fmt.Errorf("lib.ReadExtent() failed: %w", err)
-			}
-			blockStmts = append(blockStmts, gap)
+			blocks = append(blocks, &lib.ReplaceBlock{
+				Old: lib.Extent{Start: call.OuterStmt.Start, End: call.OuterStmt.Start},
+				New: stmtNodes(stmts),
+			}, &lib.ReplaceBlock{
+				Old: callExtent,
+			})
+		} else {
+			blocks = append(blocks, &lib.ReplaceBlock{
+				Old: callExtent,
+				New: stmtNodes(stmts),
+			})
 		}
 	}
-	gapExtent := &lib.Extent{
-		Start: gapStart,
-		End:   block.BodyEnd(),
-	}
-	gap, err := lib.ReadExtent(file, gapExtent)
+	start, end := block.BodyStart(), block.BodyEnd()
+	start.Offset--
+	end.Offset++
+	body, err := src.Rewrite(&lib.Extent{Start: start, End: end}, blocks)
 	if err != nil {
-		return nil, fmt.Errorf("lib.ReadExtent() failed: %w", err)
+		return nil, fmt.Errorf("src.Rewrite() failed: %w", err)
 	}
-	blockStmts = append(blockStmts, gap)
-	return blockStmts, nil
+	return body.(*ast.BlockStmt).List, nil
 }
 
-func genErrHandlers(file *os.File, block *Catch, catchErrVar string, handlerStmts []string, errorsPkg string) ([]string, error) {
-	targets, err := lib.ReadExtentList(file, block.Targets)
+func genErrHandlers(src *lib.Source, block *Catch, catchErrVar string, handlerStmts []ast.Stmt, errorsPkg string) ([]ast.Stmt, error) {
+	targets, err := src.Exprs(block.Targets)
 	if err != nil {
-		return nil, fmt.Errorf("lib.ReadExtentList() failed: %w", err)
+		return nil, fmt.Errorf("src.Exprs() failed: %w", err)
 	}
-	if len(errorsPkg) > 0 {
-		errorsPkg += "."
+	var stmts []ast.Stmt
+	if len(block.Err) > 0 && block.Err != "_" {
+		stmts = append(stmts, GenAssigneStmt(lib.Idents(block.Err), token.DEFINE, lib.Idents(catchErrVar)))
 	}
-	var blockStmts []string
+	stmts = append(stmts, GenAssigneStmt(lib.Idents(catchErrVar), token.ASSIGN, lib.Idents("nil")))
+	stmts = append(stmts, handlerStmts...)
+
+	var blockStmts []ast.Stmt
 	if block.Type == CatchError {
 		if len(targets) > 0 {
-			blockStmts = append(blockStmts,
-				GenErrIsHandler(errorsPkg, catchErrVar, targets,
-					append([]string{
-						GenAssigneStmt([]string{block.Err}, ":=", []string{catchErrVar}),
-						GenAssigneStmt([]string{catchErrVar}, "=", []string{"nil"}),
-					}, handlerStmts...),
-				),
-			)
+			blockStmts = append(blockStmts, GenErrIsHandler(errorsPkg, catchErrVar, targets, stmts))
 		} else {
-			blockStmts = append(blockStmts,
-				GenErrHandler(catchErrVar,
-					append([]string{
-						GenAssigneStmt([]string{block.Err}, ":=", []string{catchErrVar}),
-						GenAssigneStmt([]string{catchErrVar}, "=", []string{"nil"}),
-					}, handlerStmts...),
-				),
-			)
+			blockStmts = append(blockStmts, GenErrHandler(catchErrVar, stmts))
 		}
 	} else if block.Type == CatchType {
-		blockStmts = append(blockStmts,
-			GenErrAsHandler(errorsPkg, catchErrVar, targets,
-				append([]string{
-					GenAssigneStmt([]string{block.Err}, ":=", []string{catchErrVar}),
-					GenAssigneStmt([]string{catchErrVar}, "=", []string{"nil"}),
-				}, handlerStmts...),
-			),
-		)
+		blockStmts = append(blockStmts, GenErrAsHandler(errorsPkg, catchErrVar, targets, stmts))
 	}
 	return blockStmts, nil
 }
 
-func (*Translator) Generate(info *lib.FileInfo[*ExceptionSyntax], writer io.Writer) error {
-	return lib.GenerateSyntax(info, writer, func(file *os.File, addImports map[string]string) ([]*lib.ReplaceBlock, error) {
-		var ret []*lib.ReplaceBlock
-		for _, s := range info.Syntax {
-			var stmts []string
+func (t *Translator) Generate(info *lib.FileInfo[*ExceptionSyntax], writer io.Writer) error {
+	return lib.GenerateSyntax(info, writer, func(src *lib.Source, addImports map[string]string) ([]*lib.ReplaceBlock, error) {
+		return t.Edit(info, src, addImports)
+	})
+}
 
-			retTypes, err := lib.ReadExtentList(file, s.RetTypes)
-			if err != nil {
-				return nil, fmt.Errorf("lib.ReadExtentList() failed: %w", err)
-			}
-			var resultVars []string
-			var catchErrVar string
-			for idx, typ := range retTypes {
-				if idx < len(retTypes)-1 {
-					rVar := lib.GenVarName("result", s.RetTypes[idx].String())
-					resultVars = append(resultVars, rVar)
-					stmts = append(stmts, GenVarDecl(rVar, typ))
-				} else {
-					catchErrVar = lib.GenVarName("catchErr", s.RetTypes[idx].String())
-					stmts = append(stmts, GenVarDecl(catchErrVar, typ))
-				}
+func (*Translator) Edit(info *lib.FileInfo[*ExceptionSyntax], src *lib.Source, addImports map[string]string) ([]*lib.ReplaceBlock, error) {
+	var ret []*lib.ReplaceBlock
+	for _, s := range info.Syntax {
+		var stmts []ast.Stmt
+
+		retTypes, err := src.Exprs(s.RetTypes)
+		if err != nil {
+			return nil, fmt.Errorf("src.Exprs() failed: %w", err)
+		}
+		var resultVars []string
+		var catchErrVar string
+		for idx, typ := range retTypes {
+			if idx < len(retTypes)-1 {
+				rVar := lib.GenVarName("result", s.RetTypes[idx].String())
+				resultVars = append(resultVars, rVar)
+				stmts = append(stmts, GenVarDecl(rVar, typ))
+			} else {
+				catchErrVar = lib.GenVarName("catchErr", s.RetTypes[idx].String())
+				stmts = append(stmts, GenVarDecl(catchErrVar, typ))
 			}
-			hasReturnVar := lib.GenVarName("hasRet", s.Start.String())
-			stmts = append(stmts, GenVarDecl(hasReturnVar, "bool"))
-			catchLabel := lib.GenVarName("Catch", s.Blocks[0].String())
-			finallyLabel := lib.GenVarName("Finally", s.String())
-
-			for blockIdx, b := range s.Blocks {
-				var blockStmts []string
-				switch block := b.(type) {
-				case *Try:
-					{
-						handlerStmts, err := genBlockCalls(file, block, func(c CallStmt) (stmts []string, err error) {
-							switch call := c.(type) {
-							case *Func:
-								stmts, err = genFuncStmt(file, call, catchErrVar, catchLabel)
-								if err != nil {
-									err = fmt.Errorf("genFuncStmt() failed: %w", err)
-								}
-							case *Throw:
-								stmts, err = genThrowStmt(file, call, catchErrVar, catchLabel)
-								if err != nil {
-									err = fmt.Errorf("genThrowStmt() failed: %w", err)
-								}
-							case *Return:
-								stmts, err = genReturnStmt(file, call, resultVars, hasReturnVar, "", finallyLabel)
-								if err != nil {
-									err = fmt.Errorf("genReturnStmt() failed: %w", err)
-								}
-							default:
-								err = fmt.Errorf("unexpected call")
+		}
+		hasReturnVar := lib.GenVarName("hasRet", s.Start.String())
+		stmts = append(stmts, GenVarDecl(hasReturnVar, ast.NewIdent("bool")))
+		catchLabel := lib.GenVarName("Catch", s.Blocks[0].String())
+		finallyLabel := lib.GenVarName("Finally", s.String())
+		// Return() and Throw() in the Finally body jump to a return check after it, so the
+		// generated block never ends with a return and the statements following it stay reachable
+		finallyEndLabel := lib.GenVarName("FinallyEnd", s.String())
+		var finallyReturns bool
+		returnCheck := func() ast.Stmt {
+			return GenIfStmt(
+				GenOrExpr(ast.NewIdent(hasReturnVar), GenCompareExpr(ast.NewIdent(catchErrVar), token.NEQ, ast.NewIdent("nil"))),
+				[]ast.Stmt{
+					GenReturns(lib.Idents(append(resultVars, catchErrVar)...)),
+				},
+			)
+		}
+
+		// the label declared before a block is attached to it
+		var label string
+		for blockIdx, b := range s.Blocks {
+			var blockStmts []ast.Stmt
+			switch block := b.(type) {
+			case *Try:
+				{
+					handlerStmts, err := genBlockCalls(src, block, func(c CallStmt) (stmts []ast.Stmt, err error) {
+						switch call := c.(type) {
+						case *Func:
+							stmts, err = genFuncStmt(src, call, catchErrVar, catchLabel)
+							if err != nil {
+								err = fmt.Errorf("genFuncStmt() failed: %w", err)
 							}
-							return
-						})
-						if err != nil {
-							return nil, err
+						case *Throw:
+							stmts, err = genThrowStmt(src, call, catchErrVar, catchLabel)
+							if err != nil {
+								err = fmt.Errorf("genThrowStmt() failed: %w", err)
+							}
+						case *Return:
+							stmts, err = genReturnStmt(src, call, resultVars, hasReturnVar, "", finallyLabel)
+							if err != nil {
+								err = fmt.Errorf("genReturnStmt() failed: %w", err)
+							}
+						default:
+							err = fmt.Errorf("unexpected call")
 						}
-						blockStmts = append(blockStmts, handlerStmts...)
-						blockStmts = append(blockStmts, GenGotoStmt(finallyLabel))
+						return
+					})
+					if err != nil {
+						return nil, err
 					}
-				case *Catch:
-					{
-						handlerStmts, err := genBlockCalls(file, block, func(c CallStmt) (stmts []string, err error) {
-							switch call := c.(type) {
-							case *Func:
-								stmts, err = genFuncStmt(file, call, catchErrVar, finallyLabel)
-								if err != nil {
-									err = fmt.Errorf("genFuncStmt() failed: %w", err)
-								}
-							case *Throw:
-								stmts, err = genThrowStmt(file, call, catchErrVar, finallyLabel)
-								if err != nil {
-									err = fmt.Errorf("genThrowStmt() failed: %w", err)
-								}
-							case *Return:
-								stmts, err = genReturnStmt(file, call, resultVars, hasReturnVar, "", finallyLabel)
-								if err != nil {
-									err = fmt.Errorf("genReturnStmt() failed: %w", err)
-								}
-							default:
-								err = fmt.Errorf("unexpected call")
+					blockStmts = append(blockStmts, handlerStmts...)
+					blockStmts = appendGoto(blockStmts, finallyLabel)
+				}
+			case *Catch:
+				{
+					handlerStmts, err := genBlockCalls(src, block, func(c CallStmt) (stmts []ast.Stmt, err error) {
+						switch call := c.(type) {
+						case *Func:
+							stmts, err = genFuncStmt(src, call, catchErrVar, finallyLabel)
+							if err != nil {
+								err = fmt.Errorf("genFuncStmt() failed: %w", err)
 							}
-							return
-						})
-						if err != nil {
-							return nil, err
-						}
-						handlerStmts = append(handlerStmts, GenGotoStmt(finallyLabel))
-						errorsPkg, ok := info.Imports[stdErrorsPkgPath]
-						if !ok {
-							errorsPkg = lib.GenPkgName(path.Base(stdErrorsPkgPath), stdErrorsPkgPath)
-							addImports[stdErrorsPkgPath] = errorsPkg
-						}
-						handlerStmts, err = genErrHandlers(file, block, catchErrVar, handlerStmts, errorsPkg)
-						if err != nil {
-							return nil, err
+						case *Throw:
+							stmts, err = genThrowStmt(src, call, catchErrVar, finallyLabel)
+							if err != nil {
+								err = fmt.Errorf("genThrowStmt() failed: %w", err)
+							}
+						case *Return:
+							stmts, err = genReturnStmt(src, call, resultVars, hasReturnVar, "", finallyLabel)
+							if err != nil {
+								err = fmt.Errorf("genReturnStmt() failed: %w", err)
+							}
+						default:
+							err = fmt.Errorf("unexpected call")
 						}
-						blockStmts = append(blockStmts, handlerStmts...)
+						return
+					})
+					if err != nil {
+						return nil, err
 					}
-				case *Finally:
-					{
-						stmts = append(stmts, GenLabelDecl(finallyLabel))
-
-						handlerStmts, err := genBlockCalls(file, block, func(c CallStmt) (stmts []string, err error) {
-							switch call := c.(type) {
-							case *Func:
-								var callStr string
-								callStr, err = lib.ReadExtent(file, &call.Extent)
-								if err == nil {
-									stmts = append(stmts, callStr)
-								}
-							case *Return:
-								stmts, err = genReturnStmt(file, call, resultVars, "", catchErrVar, "")
+					handlerStmts = appendGoto(handlerStmts, finallyLabel)
+					errorsPkg, ok := info.Imports[stdErrorsPkgPath]
+					if !ok {
+						errorsPkg = lib.GenPkgName(path.Base(stdErrorsPkgPath), stdErrorsPkgPath)
+						addImports[stdErrorsPkgPath] = errorsPkg
+					}
+					handlerStmts, err = genErrHandlers(src, block, catchErrVar, handlerStmts, errorsPkg)
+					if err != nil {
+						return nil, err
+					}
+					blockStmts = append(blockStmts, handlerStmts...)
+				}
+			case *Finally:
+				{
+					label = finallyLabel
+
+					handlerStmts, err := genBlockCalls(src, block, func(c CallStmt) (stmts []ast.Stmt, err error) {
+						switch call := c.(type) {
+						case *Func:
+							if call.TryFunc {
+								finallyReturns = true
+								stmts, err = genFuncStmt(src, call, catchErrVar, finallyEndLabel)
 								if err != nil {
-									err = fmt.Errorf("genReturnStmt() failed: %w", err)
+									err = fmt.Errorf("genFuncStmt() failed: %w", err)
 								}
-							default:
-								err = fmt.Errorf("unexpected call")
+								break
 							}
-							return
-						})
-						if err != nil {
-							return nil, err
+							var stmt ast.Stmt
+							stmt, err = src.Stmt(&call.Extent)
+							if err == nil {
+								stmts = append(stmts, stmt)
+							}
+						case *Throw:
+							finallyReturns = true
+							stmts, err = genFinallyThrowStmt(src, call, hasReturnVar, catchErrVar, finallyEndLabel)
+							if err != nil {
+								err = fmt.Errorf("genFinallyThrowStmt() failed: %w", err)
+							}
+						case *Return:
+							finallyReturns = true
+							stmts, err = genReturnStmt(src, call, resultVars, hasReturnVar, "", finallyEndLabel)
+							if err != nil {
+								err = fmt.Errorf("genReturnStmt() failed: %w", err)
+							}
+						default:
+							err = fmt.Errorf("unexpected call")
 						}
-						blockStmts = append(blockStmts, handlerStmts...)
-						blockStmts = append(blockStmts, GenIfStmt(
-							GenOrExpr(hasReturnVar, GenCompareExpr(catchErrVar, "!=", "nil")),
-							[]string{
-								GenReturns(append(resultVars, catchErrVar)),
-							},
-						))
+						return
+					})
+					if err != nil {
+						return nil, err
 					}
-				}
-				stmts = append(stmts, GenBlock(blockStmts))
-
-				if blockIdx == 0 {
-					stmts = append(stmts, GenLabelDecl(catchLabel))
-					if !s.HasCatch {
-						stmts = append(stmts, GenBlock([]string{
-							GenGotoStmt(finallyLabel),
-						}))
+					blockStmts = append(blockStmts, handlerStmts...)
+					if !finallyReturns {
+						blockStmts = append(blockStmts, returnCheck())
 					}
 				}
 			}
-			if !s.HasFinally {
-				stmts = append(stmts, GenLabelDecl(finallyLabel))
-				stmts = append(stmts, GenBlock([]string{
-					GenIfStmt(
-						GenOrExpr(hasReturnVar, GenCompareExpr(catchErrVar, "!=", "nil")),
-						[]string{
-							GenReturns(append(resultVars, catchErrVar)),
-						},
-					),
-				}))
+			stmts = append(stmts, GenLabelDecl(label, GenBlock(blockStmts)))
+			label = ""
+
+			if blockIdx == 0 {
+				label = catchLabel
+				if !s.HasCatch {
+					stmts = append(stmts, GenLabelDecl(label, GenBlock([]ast.Stmt{
+						GenGotoStmt(finallyLabel),
+					})))
+					label = ""
+				}
 			}
-			ret = append(ret, &lib.ReplaceBlock{
-				Old: s.Extent,
-				New: GenBlock(stmts),
-			})
 		}
-		for path := range addImports {
-			if path == exceptionPkgPath {
-				delete(addImports, path)
+		if !s.HasFinally {
+			stmts = append(stmts, GenLabelDecl(finallyLabel, GenBlock([]ast.Stmt{returnCheck()})))
+		}
+		if finallyReturns {
+			stmts = append(stmts, GenLabelDecl(finallyEndLabel, returnCheck()))
+		}
+		ret = append(ret, &lib.ReplaceBlock{
+			Old: s.Extent,
+			New: []ast.Node{GenBlock(stmts)},
+		})
+	}
+	var tryFuncCalls, loweredTryFuncCalls int
+	for _, s := range info.Syntax {
+		tryFuncCalls = s.TryFuncCalls
+		for _, b := range s.Blocks {
+			for _, c := range b.CallStmts() {
+				if call, ok := c.(*Func); ok && call.TryFunc {
+					loweredTryFuncCalls++
+				}
 			}
 		}
-		return ret, nil
-	})
+	}
+	for path := range addImports {
+		if path == exceptionPkgPath || (path == tryFuncPkgPath && loweredTryFuncCalls >= tryFuncCalls) {
+			delete(addImports, path)
+		}
+	}
+	return ret, nil
+}
+
+func (t *Translator) Translation() lib.Translation {
+	return lib.NewTranslation[*lib.Extent, *ExceptionSyntax](t)
 }
 
-func (t *Translator) Run(ctx context.Context, rootDir string, firstRun bool) error {
-	err := lib.TranslateSyntax(ctx, rootDir, firstRun, t)
+func (t *Translator) Run(ctx context.Context, cfg *lib.Config, firstRun bool) error {
+	err := lib.TranslateSyntax(ctx, cfg, firstRun, t)
 	if err != nil {
 		return fmt.Errorf("translate exception syntax failed: %w", err)
 	}
@@ -2,9 +2,11 @@ module github.com/arcane-craft/sugar/tool/transform
 
 go 1.21
 
-require golang.org/x/tools v0.20.0
-
 require (
-	golang.org/x/mod v0.17.0 // indirect
-	golang.org/x/sync v0.7.0 // indirect
+	github.com/fsnotify/fsnotify v1.9.0
+	golang.org/x/mod v0.17.0
+	golang.org/x/sync v0.7.0
+	golang.org/x/tools v0.20.0
 )
+
+require golang.org/x/sys v0.19.0 // indirect
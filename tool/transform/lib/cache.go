@@ -0,0 +1,308 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/types"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+type CacheEntry struct {
+	Key         string            `json:"key"`
+	Outputs     map[string]string `json:"outputs,omitempty"`
+	Diagnostics Diagnostics       `json:"diagnostics,omitempty"`
+}
+
+type Cache struct {
+	Packages map[string]*CacheEntry `json:"packages"`
+
+	path string
+	salt string
+}
+
+func DefaultCachePath(rootDir string) (string, error) {
+	rootDir, err := filepath.Abs(rootDir)
+	if err != nil {
+		return "", fmt.Errorf("filepath.Abs() failed: %w", err)
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("os.UserCacheDir() failed: %w", err)
+	}
+	sum := sha256.Sum256([]byte(rootDir))
+	return filepath.Join(cacheDir, "sugar", "cache", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// the salt identifies everything besides the sources that affects the output, e.g. tool version and enabled syntaxes
+func LoadCache(path string, salt string) (*Cache, error) {
+	c := &Cache{Packages: make(map[string]*CacheEntry), path: path, salt: salt}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return c, nil
+		}
+		return nil, fmt.Errorf("os.ReadFile() failed: %w", err)
+	}
+	if err := json.Unmarshal(content, c); err != nil || c.Packages == nil {
+		// a corrupted cache only costs a full run
+		c.Packages = make(map[string]*CacheEntry)
+	}
+	return c, nil
+}
+
+func (c *Cache) Save() error {
+	for dir := range c.Packages {
+		if _, err := os.Stat(dir); err != nil {
+			delete(c.Packages, dir)
+		}
+	}
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent() failed: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("os.MkdirAll() failed: %w", err)
+	}
+	if err := os.WriteFile(c.path, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("os.WriteFile() failed: %w", err)
+	}
+	return nil
+}
+
+func exportHash(pkg *types.Package) string {
+	if pkg == nil {
+		return ""
+	}
+	hash := sha256.New()
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+		fmt.Fprintln(hash, types.ObjectString(obj, nil))
+		if named, ok := obj.Type().(*types.Named); ok && obj == named.Obj() {
+			for idx := 0; idx < named.NumMethods(); idx++ {
+				fmt.Fprintln(hash, types.ObjectString(named.Method(idx), nil))
+			}
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func packageKey(p *packages.Package, salt string, manifest *Manifest) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n", salt, p.PkgPath)
+
+	files := slices.Clone(p.GoFiles)
+	slices.Sort(files)
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("os.ReadFile() failed: %w", err)
+		}
+		// directives added by the tool do not change the output
+		if manifest.IsTagged(file) {
+			content = bytes.TrimPrefix(content, []byte(GenBuildTags(false)))
+		}
+		fmt.Fprintf(hash, "%s %d\n", filepath.Base(file), len(content))
+		hash.Write(content)
+	}
+
+	var imports []string
+	for path := range p.Imports {
+		imports = append(imports, path)
+	}
+	slices.Sort(imports)
+	for _, path := range imports {
+		fmt.Fprintf(hash, "%s %s\n", path, exportHash(p.Imports[path].Types))
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func packageOutputs(dir string) (map[string]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*_"+prodBuildTag+".go"))
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Glob() failed: %w", err)
+	}
+	mapFiles, err := filepath.Glob(PositionMapFile(filepath.Join(dir, "*_"+prodBuildTag+".go")))
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Glob() failed: %w", err)
+	}
+	files = append(files, mapFiles...)
+	outputs := make(map[string]string)
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("os.ReadFile() failed: %w", err)
+		}
+		sum := sha256.Sum256(content)
+		outputs[filepath.Base(file)] = hex.EncodeToString(sum[:])
+	}
+	return outputs, nil
+}
+
+func equalOutputs(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, sum := range a {
+		if b[name] != sum {
+			return false
+		}
+	}
+	return true
+}
+
+func stripToolDirective(cfg *Config, manifest *Manifest, file string) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("os.ReadFile() failed: %w", err)
+	}
+	if bytes.HasPrefix(content, []byte(GenBuildTags(false))) {
+		cfg.Logf("strip build directive from %s", file)
+		content = bytes.TrimPrefix(content, []byte(GenBuildTags(false)))
+		if err := os.WriteFile(file, content, 0644); err != nil {
+			return fmt.Errorf("os.WriteFile() failed: %w", err)
+		}
+	}
+	manifest.RemoveTagged(file)
+	return nil
+}
+
+// generated files whose source was removed, and tool-added directives of sources that no longer generate anything
+func removeOrphans(cfg *Config, manifest *Manifest, dirs map[string]bool) error {
+	for _, rel := range slices.Clone(manifest.Generated) {
+		file := filepath.Join(manifest.rootDir, filepath.FromSlash(rel))
+		source := strings.TrimSuffix(file, "_"+prodBuildTag+".go") + ".go"
+		if _, err := os.Stat(source); err == nil {
+			continue
+		}
+		cfg.Logf("remove orphaned %s", file)
+		for _, f := range []string{file, PositionMapFile(file)} {
+			if err := os.Remove(f); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("os.Remove() failed: %w", err)
+			}
+		}
+		manifest.RemoveGenerated(file)
+	}
+	for _, rel := range slices.Clone(manifest.Tagged) {
+		file := filepath.Join(manifest.rootDir, filepath.FromSlash(rel))
+		if !dirs[filepath.Dir(file)] {
+			continue
+		}
+		if _, err := os.Stat(ProductionFileName(file)); err == nil {
+			continue
+		}
+		if err := stripToolDirective(cfg, manifest, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Incremental(ctx context.Context, cfg *Config, cache *Cache, run func(ctx context.Context, cfg *Config) error) error {
+	rootDir, err := filepath.Abs(cfg.RootDir)
+	if err != nil {
+		return fmt.Errorf("filepath.Abs() failed: %w", err)
+	}
+	manifest, err := LoadManifest(rootDir)
+	if err != nil {
+		return fmt.Errorf("load manifest failed: %w", err)
+	}
+	if err := removeOrphans(cfg, manifest, nil); err != nil {
+		return err
+	}
+	if err := manifest.Save(); err != nil {
+		return fmt.Errorf("save manifest failed: %w", err)
+	}
+
+	pkgs, err := LoadPackages(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("load source packages failed: %w", err)
+	}
+	var diagnostics Diagnostics
+	keys := make(map[string]string)
+	changed := make(map[string]bool)
+	var patterns []string
+	for _, p := range pkgs {
+		if len(p.GoFiles) <= 0 {
+			continue
+		}
+		dir := filepath.Dir(p.GoFiles[0])
+		key, err := packageKey(p, cache.salt, manifest)
+		if err != nil {
+			return err
+		}
+		keys[dir] = key
+		outputs, err := packageOutputs(dir)
+		if err != nil {
+			return err
+		}
+		if entry := cache.Packages[dir]; entry != nil && entry.Key == key && equalOutputs(entry.Outputs, outputs) {
+			cfg.Logf("skip unchanged package %s", p.PkgPath)
+			diagnostics = append(diagnostics, entry.Diagnostics...)
+			continue
+		}
+		changed[dir] = true
+		rel, err := filepath.Rel(rootDir, dir)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel() failed: %w", err)
+		}
+		patterns = append(patterns, "./"+filepath.ToSlash(rel))
+	}
+
+	if len(patterns) > 0 {
+		runErr := run(ctx, cfg.WithPatterns(patterns))
+		var diags Diagnostics
+		if runErr != nil && !errors.As(runErr, &diags) {
+			return runErr
+		}
+		diagnostics = append(diagnostics, diags...)
+
+		manifest, err := LoadManifest(rootDir)
+		if err != nil {
+			return fmt.Errorf("load manifest failed: %w", err)
+		}
+		if err := removeOrphans(cfg, manifest, changed); err != nil {
+			return err
+		}
+		if err := manifest.Save(); err != nil {
+			return fmt.Errorf("save manifest failed: %w", err)
+		}
+
+		for dir := range changed {
+			outputs, err := packageOutputs(dir)
+			if err != nil {
+				return err
+			}
+			entry := &CacheEntry{Key: keys[dir], Outputs: outputs}
+			for _, d := range diags {
+				if filepath.Dir(d.Pos.Filename) == dir {
+					entry.Diagnostics = append(entry.Diagnostics, d)
+				}
+			}
+			cache.Packages[dir] = entry
+		}
+		if err := cache.Save(); err != nil {
+			return fmt.Errorf("save cache failed: %w", err)
+		}
+	}
+
+	if len(diagnostics) > 0 {
+		diagnostics.Sort()
+		return diagnostics
+	}
+	return nil
+}
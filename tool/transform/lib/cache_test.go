@@ -0,0 +1,95 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPackageKey(t *testing.T) {
+	base := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"a/a.go": "package a\n\nimport \"example.com/m/b\"\n\nvar V = b.F()\n",
+		"b/b.go": "package b\n\nfunc F() int { return 1 }\n",
+	}
+	tests := []struct {
+		name    string
+		files   map[string]string
+		salt    string
+		tagged  bool
+		changed bool
+	}{
+		{name: "unchanged"},
+		{name: "salt", salt: "other", changed: true},
+		{
+			name:    "source",
+			files:   map[string]string{"a/a.go": "package a\n\nimport \"example.com/m/b\"\n\nvar V = b.F() + 1\n"},
+			changed: true,
+		},
+		{
+			name:  "dependency body",
+			files: map[string]string{"b/b.go": "package b\n\nfunc F() int { return 2 }\n"},
+		},
+		{
+			name:    "dependency api",
+			files:   map[string]string{"b/b.go": "package b\n\nfunc F() int64 { return 1 }\n"},
+			changed: true,
+		},
+		{
+			name:   "tool directive",
+			files:  map[string]string{"a/a.go": GenBuildTags(false) + base["a/a.go"]},
+			tagged: true,
+		},
+		{
+			name:    "user directive",
+			files:   map[string]string{"a/a.go": GenBuildTags(false) + base["a/a.go"]},
+			changed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles := func(files map[string]string) {
+				for name, content := range files {
+					path := filepath.Join(dir, filepath.FromSlash(name))
+					if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+						t.Fatalf("os.MkdirAll() failed: %v", err)
+					}
+					if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+						t.Fatalf("os.WriteFile() failed: %v", err)
+					}
+				}
+			}
+			key := func(salt string, manifest *Manifest) string {
+				pkgs, err := LoadPackages(context.Background(), &Config{RootDir: dir, Patterns: []string{"./a"}})
+				if err != nil {
+					t.Fatalf("LoadPackages() failed: %v", err)
+				}
+				key, err := packageKey(pkgs[0], salt, manifest)
+				if err != nil {
+					t.Fatalf("packageKey() failed: %v", err)
+				}
+				return key
+			}
+
+			writeFiles(base)
+			manifest, err := LoadManifest(dir)
+			if err != nil {
+				t.Fatalf("LoadManifest() failed: %v", err)
+			}
+			old := key("salt", manifest)
+			writeFiles(tt.files)
+			if tt.tagged {
+				manifest.AddTagged(filepath.Join(dir, "a", "a.go"))
+			}
+			salt := tt.salt
+			if len(salt) <= 0 {
+				salt = "salt"
+			}
+			if changed := key(salt, manifest) != old; changed != tt.changed {
+				t.Errorf("got changed %t, want %t", changed, tt.changed)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+)
+
+func Clean(ctx context.Context, cfg *Config) error {
+	manifest, err := LoadManifest(cfg.RootDir)
+	if err != nil {
+		return fmt.Errorf("LoadManifest() failed: %w", err)
+	}
+
+	fileSet := make(map[string]*Extent)
+	for _, tags := range [][]string{nil, {prodBuildTag}, {tmpBuildTag}} {
+		pkgs, err := LoadPackages(ctx, cfg, tags...)
+		if err != nil {
+			return fmt.Errorf("load source packages failed: %w", err)
+		}
+		for _, p := range pkgs {
+			for file, extent := range FindPackageBuildTags(p) {
+				fileSet[file] = extent
+			}
+		}
+	}
+	var files []string
+	for file := range fileSet {
+		files = append(files, file)
+	}
+	slices.Sort(files)
+
+	for _, file := range files {
+		if strings.HasSuffix(file, "_"+prodBuildTag+".go") {
+			cfg.Logf("remove %s", file)
+			if err := os.Remove(file); err != nil {
+				return fmt.Errorf("os.Remove() failed: %w", err)
+			}
+			if err := os.Remove(PositionMapFile(file)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("os.Remove() failed: %w", err)
+			}
+			manifest.RemoveGenerated(file)
+			continue
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("os.ReadFile() failed: %w", err)
+		}
+		// directives written by users are restored to their original line, those added by the tool are stripped
+		if !manifest.IsTagged(file) {
+			if line, ok := manifest.Directive(file); ok {
+				extent := fileSet[file]
+				if current := string(content[extent.Start.Offset:extent.End.Offset]); current != line {
+					cfg.Logf("restore build directive of %s", file)
+					content = slices.Concat(content[:extent.Start.Offset], []byte(line), content[extent.End.Offset:])
+					if err := os.WriteFile(file, content, 0644); err != nil {
+						return fmt.Errorf("os.WriteFile() failed: %w", err)
+					}
+				}
+				manifest.RemoveDirective(file)
+			}
+			continue
+		}
+		for _, directive := range []string{GenBuildTags(false), GenTmpBuildTags(false)} {
+			if bytes.HasPrefix(content, []byte(directive)) {
+				cfg.Logf("strip build directive from %s", file)
+				content = bytes.TrimPrefix(content, []byte(directive))
+				if err := os.WriteFile(file, content, 0644); err != nil {
+					return fmt.Errorf("os.WriteFile() failed: %w", err)
+				}
+				break
+			}
+		}
+		manifest.RemoveTagged(file)
+		manifest.RemoveDirective(file)
+	}
+
+	if err := manifest.Save(); err != nil {
+		return fmt.Errorf("save manifest failed: %w", err)
+	}
+	return nil
+}
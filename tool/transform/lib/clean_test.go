@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	dir := t.TempDir()
+	// the tree as an interrupted transform leaves it
+	files := map[string]string{
+		"go.mod":                     "module example.com/m\n\ngo 1.22\n",
+		"user.go":                    "//go:build !sugar_temp\n\npackage m\n",
+		"written.go":                 "//go:build !sugar_temp\n\npackage m\n",
+		"tagged.go":                  "//go:build !sugar_temp\n\npackage m\n\nfunc F() {}\n",
+		"tagged_sugar_production.go": "//go:build sugar_temp\n\npackage m\n\nfunc F() {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("os.WriteFile() failed: %v", err)
+		}
+	}
+	m, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("LoadManifest() failed: %v", err)
+	}
+	m.AddGenerated(filepath.Join(dir, "tagged_sugar_production.go"))
+	m.AddTagged(filepath.Join(dir, "tagged.go"))
+	m.SetDirective(filepath.Join(dir, "user.go"), "//go:build !sugar_production")
+	if err := m.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	if err := Clean(context.Background(), &Config{RootDir: dir}); err != nil {
+		t.Fatalf("Clean() failed: %v", err)
+	}
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"user.go", "//go:build !sugar_production\n\npackage m\n"},
+		{"written.go", "//go:build !sugar_temp\n\npackage m\n"},
+		{"tagged.go", "package m\n\nfunc F() {}\n"},
+		{"tagged_sugar_production.go", ""},
+		{ManifestFile, ""},
+	}
+	for _, tt := range tests {
+		content, err := os.ReadFile(filepath.Join(dir, tt.file))
+		if tt.want == "" {
+			if !os.IsNotExist(err) {
+				t.Errorf("%s was kept", tt.file)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("os.ReadFile() failed: %v", err)
+		}
+		if string(content) != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.file, content, tt.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+type Config struct {
+	RootDir   string
+	Patterns  []string
+	BuildTags []string
+	Verbose   bool
+	Jobs      int
+
+	Manifest *Manifest
+}
+
+func (c *Config) WithRootDir(rootDir string) *Config {
+	ret := *c
+	ret.RootDir = rootDir
+	ret.Manifest = nil
+	return &ret
+}
+
+func (c *Config) WithPatterns(patterns []string) *Config {
+	ret := *c
+	ret.Patterns = patterns
+	return &ret
+}
+
+func (c *Config) WithManifest(manifest *Manifest) *Config {
+	ret := *c
+	ret.Manifest = manifest
+	return &ret
+}
+
+func (c *Config) patterns() []string {
+	if len(c.Patterns) <= 0 {
+		return []string{"./..."}
+	}
+	return c.Patterns
+}
+
+func (c *Config) buildFlags(tags ...string) []string {
+	tags = append(append([]string(nil), c.BuildTags...), tags...)
+	if len(tags) <= 0 {
+		return nil
+	}
+	return []string{"-tags=" + strings.Join(tags, ",")}
+}
+
+func (c *Config) jobs() int {
+	if c.Jobs <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return c.Jobs
+}
+
+func (c *Config) Logf(format string, args ...any) {
+	if c.Verbose {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	}
+}
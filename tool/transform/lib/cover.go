@@ -0,0 +1,190 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/cover"
+	"golang.org/x/tools/go/packages"
+)
+
+// the directories of the packages coverage profiles refer to by import path
+func profileDirs(ctx context.Context, cfg *Config, profiles []*cover.Profile) (map[string]string, error) {
+	var pkgPaths []string
+	for _, p := range profiles {
+		if !filepath.IsAbs(p.FileName) {
+			if pkgPath := path.Dir(p.FileName); !slices.Contains(pkgPaths, pkgPath) {
+				pkgPaths = append(pkgPaths, pkgPath)
+			}
+		}
+	}
+	dirs := make(map[string]string)
+	if len(pkgPaths) <= 0 {
+		return dirs, nil
+	}
+	loadCfg := &packages.Config{
+		Mode:       packages.NeedName | packages.NeedFiles,
+		Context:    ctx,
+		Dir:        cfg.RootDir,
+		Env:        os.Environ(),
+		BuildFlags: cfg.buildFlags(prodBuildTag),
+	}
+	pkgs, err := packages.Load(loadCfg, pkgPaths...)
+	if err != nil {
+		return nil, fmt.Errorf("packages.Load() failed: %w", err)
+	}
+	for _, p := range pkgs {
+		if files := append(p.GoFiles, p.IgnoredFiles...); len(files) > 0 {
+			dirs[p.PkgPath] = filepath.Dir(files[0])
+		}
+	}
+	return dirs, nil
+}
+
+type coverKey struct {
+	file                                 string
+	startLine, startCol, endLine, endCol int
+}
+
+// RemapCoverProfile rewrites a coverage profile of code built with the production tag so
+// that the blocks of generated files refer to the sources they were generated from, using
+// the position maps saved with the generated files. Blocks ending up on the same source
+// range are merged.
+func RemapCoverProfile(ctx context.Context, cfg *Config, r io.Reader, w io.Writer) error {
+	profiles, err := cover.ParseProfilesFromReader(r)
+	if err != nil {
+		return fmt.Errorf("cover.ParseProfilesFromReader() failed: %w", err)
+	}
+	if len(profiles) <= 0 {
+		return nil
+	}
+	dirs, err := profileDirs(ctx, cfg, profiles)
+	if err != nil {
+		return err
+	}
+	mode := profiles[0].Mode
+
+	sources := make(map[string][][]byte)
+	sourceLine := func(file string, line int) []byte {
+		lines, ok := sources[file]
+		if !ok {
+			if content, err := os.ReadFile(file); err == nil {
+				lines = bytes.Split(content, []byte("\n"))
+			}
+			sources[file] = lines
+		}
+		if line <= 0 || line > len(lines) {
+			return nil
+		}
+		return lines[line-1]
+	}
+
+	blocks := make(map[coverKey]*cover.ProfileBlock)
+	var keys []coverKey
+	add := func(key coverKey, b cover.ProfileBlock) {
+		if merged, ok := blocks[key]; ok {
+			merged.NumStmt += b.NumStmt
+			if mode == "set" {
+				merged.Count = max(merged.Count, b.Count)
+			} else {
+				merged.Count += b.Count
+			}
+			return
+		}
+		blocks[key] = &b
+		keys = append(keys, key)
+	}
+
+	for _, p := range profiles {
+		// profiles name files by import path, unless the packages were given as directories
+		dir, join := filepath.Dir(p.FileName), filepath.Join
+		if !filepath.IsAbs(p.FileName) {
+			dir, join = dirs[path.Dir(p.FileName)], path.Join
+		}
+		// the code of a generated file is named after its source once a //line directive is
+		// in effect, and after the generated file before
+		name := path.Base(filepath.ToSlash(p.FileName))
+		genFile := filepath.Join(dir, name)
+		if !IsProductionFile(name) {
+			genFile = ProductionFileName(genFile)
+		}
+		var m *PositionMap
+		if len(dir) > 0 {
+			if _, err := os.Stat(PositionMapFile(genFile)); err == nil {
+				if m, err = LoadPositionMap(genFile); err != nil {
+					return err
+				}
+			}
+		}
+		prefix := strings.TrimSuffix(p.FileName, name)
+		for _, b := range p.Blocks {
+			if m == nil {
+				add(coverKey{p.FileName, b.StartLine, b.StartCol, b.EndLine, b.EndCol}, b)
+				continue
+			}
+			start, ok := m.lookup(b.StartLine)
+			if !ok {
+				add(coverKey{join(prefix, filepath.Base(genFile)), b.StartLine, b.StartCol, b.EndLine, b.EndCol}, b)
+				continue
+			}
+			srcFile := filepath.Join(dir, start.Source)
+			key := coverKey{file: join(prefix, filepath.ToSlash(start.Source))}
+			key.startLine = start.SourceLine + b.StartLine - start.Line
+			key.startCol = b.StartCol + start.Shift
+			if !start.Copied {
+				key.startCol = indent(sourceLine(srcFile, key.startLine)) + 1
+			}
+			// a block ending in another file, or before it starts, is cut at the end of its first line
+			key.endLine, key.endCol = key.startLine, len(bytes.TrimRight(sourceLine(srcFile, key.startLine), " \t\r"))+1
+			// blocks often end at the start of a line, which may be a directive
+			genEnd := b.EndLine
+			end, ok := m.lookup(genEnd)
+			for !ok && genEnd > b.StartLine {
+				genEnd--
+				end, ok = m.lookup(genEnd)
+			}
+			if ok && end.Source == start.Source {
+				endLine, endCol := end.SourceLine+genEnd-end.Line, b.EndCol+end.Shift
+				if !end.Copied || genEnd != b.EndLine {
+					endCol = len(bytes.TrimRight(sourceLine(srcFile, endLine), " \t\r")) + 1
+				}
+				if endLine > key.startLine || endLine == key.startLine && endCol > key.startCol {
+					key.endLine, key.endCol = endLine, endCol
+				}
+			}
+			key.startCol, key.endCol = max(key.startCol, 1), max(key.endCol, 1)
+			b.StartLine, b.StartCol, b.EndLine, b.EndCol = key.startLine, key.startCol, key.endLine, key.endCol
+			add(key, b)
+		}
+	}
+
+	slices.SortFunc(keys, func(a, b coverKey) int {
+		switch {
+		case a.file != b.file:
+			return strings.Compare(a.file, b.file)
+		case a.startLine != b.startLine:
+			return a.startLine - b.startLine
+		case a.startCol != b.startCol:
+			return a.startCol - b.startCol
+		case a.endLine != b.endLine:
+			return a.endLine - b.endLine
+		}
+		return a.endCol - b.endCol
+	})
+	buf := bytes.NewBufferString(fmt.Sprintf("mode: %s\n", mode))
+	for _, key := range keys {
+		b := blocks[key]
+		fmt.Fprintf(buf, "%s:%d.%d,%d.%d %d %d\n", key.file, b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.NumStmt, b.Count)
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("writer.Write() failed: %w", err)
+	}
+	return nil
+}
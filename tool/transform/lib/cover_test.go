@@ -0,0 +1,64 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRemapCoverProfile(t *testing.T) {
+	genFile := writeGenerated(t)
+	dir := filepath.Dir(genFile)
+	source := filepath.Join(dir, "main.go")
+	other := filepath.Join(dir, "other.go")
+
+	// blocks of the generated file, named after the source once the first //line directive is in effect
+	blocks := []string{
+		genFile + ":3.1,3.13 1 1",
+		source + ":6.33,9.16 2 3",
+		source + ":9.16,11.14 1 1",
+		source + ":11.3,11.17 1 2",
+		source + ":13.3,16.20 2 3",
+		other + ":3.1,5.2 1 4",
+	}
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{
+			mode: "count",
+			want: []string{
+				source + ":3.33,4.19 2 3",
+				source + ":4.2,4.19 2 3",
+				source + ":4.2,5.20 2 3",
+				genFile + ":3.1,3.13 1 1",
+				other + ":3.1,5.2 1 4",
+			},
+		},
+		{
+			mode: "set",
+			want: []string{
+				source + ":3.33,4.19 2 3",
+				source + ":4.2,4.19 2 2",
+				source + ":4.2,5.20 2 3",
+				genFile + ":3.1,3.13 1 1",
+				other + ":3.1,5.2 1 4",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			profile := "mode: " + tt.mode + "\n" + strings.Join(blocks, "\n") + "\n"
+			buf := bytes.NewBuffer(nil)
+			if err := RemapCoverProfile(context.Background(), &Config{RootDir: dir}, strings.NewReader(profile), buf); err != nil {
+				t.Fatalf("RemapCoverProfile() failed: %v", err)
+			}
+			want := "mode: " + tt.mode + "\n" + strings.Join(tt.want, "\n") + "\n"
+			if got := buf.String(); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"fmt"
+	"go/token"
+	"slices"
+	"strings"
+)
+
+// suggested fixes are plain text, so they can be cached and handed to go/analysis
+type TextEdit struct {
+	Old Extent
+	New string
+}
+
+type Fix struct {
+	Message string
+	Edits   []*TextEdit
+}
+
+type Diagnostic struct {
+	Pos    token.Position
+	Syntax string
+	Reason string
+	Fixes  []*Fix
+}
+
+func (d *Diagnostic) String() string {
+	if d == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%s: %s: %s", d.Pos, d.Syntax, d.Reason)
+}
+
+type Diagnostics []*Diagnostic
+
+func (d Diagnostics) Error() string {
+	return JoinStringers([]*Diagnostic(d), "\n")
+}
+
+func (d Diagnostics) Sort() {
+	slices.SortFunc(d, func(a, b *Diagnostic) int {
+		if a.Pos.Filename != b.Pos.Filename {
+			return strings.Compare(a.Pos.Filename, b.Pos.Filename)
+		}
+		if a.Pos.Offset != b.Pos.Offset {
+			return a.Pos.Offset - b.Pos.Offset
+		}
+		return strings.Compare(a.Reason, b.Reason)
+	})
+}
+
+type DiagnosticReporter interface {
+	Diagnostics() Diagnostics
+}
+
+type DiagnosticSet struct {
+	seen  map[string]bool
+	diags Diagnostics
+}
+
+func (s *DiagnosticSet) Add(diags ...*Diagnostic) {
+	if s.seen == nil {
+		s.seen = make(map[string]bool)
+	}
+	for _, d := range diags {
+		key := d.String()
+		if !s.seen[key] {
+			s.seen[key] = true
+			s.diags = append(s.diags, d)
+		}
+	}
+}
+
+func (s *DiagnosticSet) Diagnostics() Diagnostics {
+	ret := slices.Clone(s.diags)
+	ret.Sort()
+	return ret
+}
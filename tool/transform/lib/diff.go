@@ -0,0 +1,171 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContextLines = 3
+
+type diffOp struct {
+	kind byte
+	line string
+}
+
+func splitLines(content string) []string {
+	if len(content) <= 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(content, "\n")
+	if len(lines[len(lines)-1]) <= 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// created and removed files are a single hunk, which needs no search
+func pureDiff(kind byte, lines []string) []diffOp {
+	ops := make([]diffOp, 0, len(lines))
+	for _, line := range lines {
+		ops = append(ops, diffOp{kind, line})
+	}
+	return ops
+}
+
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	if n <= 0 {
+		return pureDiff('+', b)
+	}
+	if m <= 0 {
+		return pureDiff('-', a)
+	}
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+	var x, y int
+
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y = x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var ops []diffOp
+	x, y = n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d]
+		at := func(k int) int { return prev[k+d] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			ops = append(ops, diffOp{'+', b[y-1]})
+			y--
+		} else {
+			ops = append(ops, diffOp{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, diffOp{' ', a[x-1]})
+		x--
+		y--
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+func hunkRange(start, count int) string {
+	if count <= 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func UnifiedDiff(oldName, newName string, oldContent, newContent []byte) string {
+	ops := diffLines(splitLines(string(oldContent)), splitLines(string(newContent)))
+
+	var changes []int
+	for idx, op := range ops {
+		if op.kind != ' ' {
+			changes = append(changes, idx)
+		}
+	}
+	if len(changes) <= 0 {
+		return ""
+	}
+
+	oldLines := make([]int, len(ops)+1)
+	newLines := make([]int, len(ops)+1)
+	for idx, op := range ops {
+		oldLines[idx+1], newLines[idx+1] = oldLines[idx], newLines[idx]
+		if op.kind != '+' {
+			oldLines[idx+1]++
+		}
+		if op.kind != '-' {
+			newLines[idx+1]++
+		}
+	}
+
+	buf := new(strings.Builder)
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", oldName, newName)
+	for i := 0; i < len(changes); {
+		j := i
+		for j+1 < len(changes) && changes[j+1]-changes[j] <= 2*diffContextLines {
+			j++
+		}
+		start := changes[i] - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		end := changes[j] + diffContextLines + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		fmt.Fprintf(buf, "@@ -%s +%s @@\n",
+			hunkRange(oldLines[start], oldLines[end]-oldLines[start]),
+			hunkRange(newLines[start], newLines[end]-newLines[start]))
+		for _, op := range ops[start:end] {
+			buf.WriteByte(op.kind)
+			buf.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = j + 1
+	}
+	return buf.String()
+}
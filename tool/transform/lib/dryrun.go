@@ -0,0 +1,232 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+type FileChange struct {
+	Path string
+	Old  []byte
+	New  []byte
+
+	Created bool
+	Removed bool
+}
+
+func (c *FileChange) String() string {
+	switch {
+	case c.Created:
+		return "create " + c.Path
+	case c.Removed:
+		return "remove " + c.Path
+	}
+	return "modify " + c.Path
+}
+
+func (c *FileChange) UnifiedDiff() string {
+	oldName, newName := filepath.ToSlash(filepath.Join("a", c.Path)), filepath.ToSlash(filepath.Join("b", c.Path))
+	if c.Created {
+		oldName = os.DevNull
+	}
+	if c.Removed {
+		newName = os.DevNull
+	}
+	return UnifiedDiff(oldName, newName, c.Old, c.New)
+}
+
+func skipDir(d fs.DirEntry) bool {
+	return d.IsDir() && d.Name() == ".git"
+}
+
+func CopyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if skipDir(d) {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel() failed: %w", err)
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("os.Readlink() failed: %w", err)
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyFile(path, target)
+		}
+		return nil
+	})
+}
+
+func copyFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("os.Stat() failed: %w", err)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("os.Open() failed: %w", err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm()|0200)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile() failed: %w", err)
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("io.Copy() failed: %w", err)
+	}
+	return nil
+}
+
+func readTree(root string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if skipDir(d) {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel() failed: %w", err)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("os.ReadFile() failed: %w", err)
+		}
+		files[rel] = content
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func rewriteTree(root string, old string, new string) error {
+	files, err := readTree(root)
+	if err != nil {
+		return err
+	}
+	for path, content := range files {
+		if bytes.Contains(content, []byte(old)) {
+			content = bytes.ReplaceAll(content, []byte(old), []byte(new))
+			path = filepath.Join(root, path)
+			if err := os.WriteFile(path, content, 0644); err != nil {
+				return fmt.Errorf("os.WriteFile() failed: %w", err)
+			}
+			// the columns of the position map change with the length of the paths
+			if _, err := os.Stat(PositionMapFile(path)); err != nil || !IsProductionFile(path) {
+				continue
+			}
+			m, err := LoadPositionMap(path)
+			if err != nil {
+				return err
+			}
+			if err := WritePositionMap(path, m.Edits); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func DiffTree(oldDir, newDir string) ([]*FileChange, error) {
+	oldFiles, err := readTree(oldDir)
+	if err != nil {
+		return nil, fmt.Errorf("readTree() failed: %w", err)
+	}
+	newFiles, err := readTree(newDir)
+	if err != nil {
+		return nil, fmt.Errorf("readTree() failed: %w", err)
+	}
+
+	// the manifest is bookkeeping of the tool, not part of the transformed project
+	for _, files := range []map[string][]byte{oldFiles, newFiles} {
+		for path := range files {
+			if filepath.Base(path) == ManifestFile {
+				delete(files, path)
+			}
+		}
+	}
+
+	var changes []*FileChange
+	for path, oldContent := range oldFiles {
+		newContent, ok := newFiles[path]
+		if !ok {
+			changes = append(changes, &FileChange{Path: path, Old: oldContent, Removed: true})
+		} else if !bytes.Equal(oldContent, newContent) {
+			changes = append(changes, &FileChange{Path: path, Old: oldContent, New: newContent})
+		}
+	}
+	for path, newContent := range newFiles {
+		if _, ok := oldFiles[path]; !ok {
+			changes = append(changes, &FileChange{Path: path, New: newContent, Created: true})
+		}
+	}
+	slices.SortFunc(changes, func(a, b *FileChange) int {
+		if a.Path < b.Path {
+			return -1
+		} else if a.Path > b.Path {
+			return 1
+		}
+		return 0
+	})
+	return changes, nil
+}
+
+func DryRun(ctx context.Context, rootDir string, run func(ctx context.Context, rootDir string) error) ([]*FileChange, error) {
+	rootDir, err := filepath.Abs(rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Abs() failed: %w", err)
+	}
+	modRoot := findModuleRoot(rootDir)
+
+	// relative replace directives are made absolute in the copied go.mod
+	tmpDir, err := os.MkdirTemp("", "sugar-")
+	if err != nil {
+		return nil, fmt.Errorf("os.MkdirTemp() failed: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpRoot, runErr := OutOfTree(ctx, rootDir, tmpDir, run)
+	var diags Diagnostics
+	if runErr != nil && !errors.As(runErr, &diags) {
+		return nil, runErr
+	}
+	// the transformation itself never touches these files
+	os.Remove(filepath.Join(tmpDir, outputMarkerFile))
+	if _, err := os.Stat(filepath.Join(modRoot, "go.mod")); err == nil {
+		if err := copyFile(filepath.Join(modRoot, "go.mod"), filepath.Join(tmpDir, "go.mod")); err != nil {
+			return nil, fmt.Errorf("copyFile() failed: %w", err)
+		}
+	}
+
+	changes, err := DiffTree(rootDir, tmpRoot)
+	if err != nil {
+		return nil, fmt.Errorf("DiffTree() failed: %w", err)
+	}
+	return changes, runErr
+}
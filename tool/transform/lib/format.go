@@ -1,36 +1,111 @@
 package lib
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"go/ast"
+	"go/format"
+	"go/printer"
+	"go/scanner"
+	"go/token"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/imports"
 )
 
-func FormatCode(ctx context.Context, filePath string, buildTag string) error {
-	goplsPath, err := exec.LookPath("gopls")
-	if err != nil {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return fmt.Errorf("os.UserHomeDir() failed: %w", err)
+type FormatError struct {
+	Path   string
+	Source []byte
+	Err    error
+}
+
+func (e *FormatError) Error() string {
+	buf := bytes.NewBufferString(fmt.Sprintf("format %s failed: %v\n", e.Path, e.Err))
+	lines := splitLines(string(e.Source))
+	show := make([]bool, len(lines))
+	var errList scanner.ErrorList
+	if errors.As(e.Err, &errList) {
+		for _, err := range errList {
+			for line := err.Pos.Line - 3; line <= err.Pos.Line+3; line++ {
+				if line > 0 && line <= len(lines) {
+					show[line-1] = true
+				}
+			}
+		}
+	} else {
+		for idx := range show {
+			show[idx] = true
+		}
+	}
+	for idx, line := range lines {
+		if !show[idx] {
+			continue
 		}
-		goplsPath = filepath.Join(homeDir, "go", "bin", "gopls")
-		if len(goplsPath) <= 0 {
-			return fmt.Errorf("executable file \"gopls\" not found")
+		if idx > 0 && !show[idx-1] {
+			buf.WriteString("\t...\n")
 		}
+		fmt.Fprintf(buf, "%5d\t%s\n", idx+1, strings.TrimSuffix(line, "\n"))
 	}
-	cmd := exec.CommandContext(ctx, goplsPath, "format", "-w", filePath)
-	err = cmd.Run()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
+
+// the configuration of gofmt
+var printConfig = &printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+
+// generated files carry //line directives wherever their lines differ from the source,
+// the tabwriter misplaces them so the alignment is left to gofmt
+var sourcePrintConfig = &printer.Config{Mode: printer.RawFormat | printer.SourcePos, Tabwidth: 8}
+
+func FormatNode(fset *token.FileSet, node ast.Node) (string, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := format.Node(buf, fset, node); err != nil {
+		return "", fmt.Errorf("format.Node() failed: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// imports are resolved against all files of the directory whatever their build constraints,
+// so generated files are processed the same under any build tag
+func FormatSource(filePath string, src []byte) ([]byte, error) {
+	formatted, err := format.Source(src)
+	if err != nil {
+		return nil, &FormatError{Path: filePath, Source: src, Err: err}
+	}
+	formatted, err = imports.Process(filePath, formatted, &imports.Options{
+		Comments:  true,
+		TabIndent: true,
+		TabWidth:  8,
+	})
+	if err != nil {
+		return nil, &FormatError{Path: filePath, Source: src, Err: err}
+	}
+	return formatted, nil
+}
+
+func FormatCode(ctx context.Context, filePath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	src, err := os.ReadFile(filePath)
 	if err != nil {
-		return fmt.Errorf("%s failed: %w", cmd.String(), err)
+		return fmt.Errorf("os.ReadFile() failed: %w", err)
 	}
-	cmd = exec.CommandContext(ctx, goplsPath, "imports", "-w", filePath)
-	cmd.Env = append(cmd.Env, os.Environ()...)
-	cmd.Env = append(cmd.Env, fmt.Sprintf("GOFLAGS=\"-tags=%s\"", buildTag))
-	err = cmd.Run()
+	formatted, err := FormatSource(filePath, src)
 	if err != nil {
-		return fmt.Errorf("%s failed: %w", cmd.String(), err)
+		return err
+	}
+	if bytes.Equal(formatted, src) {
+		return nil
+	}
+	if err := os.WriteFile(filePath, formatted, 0644); err != nil {
+		return fmt.Errorf("os.WriteFile() failed: %w", err)
 	}
 	return nil
 }
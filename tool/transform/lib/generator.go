@@ -2,17 +2,21 @@ package lib
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"go/ast"
+	"go/token"
 	"io"
+	"io/fs"
+	"maps"
 	"os"
 	"path"
 	"slices"
+	"strconv"
 	"strings"
-)
 
-func GenNewLine() string {
-	return "\n"
-}
+	"golang.org/x/tools/go/ast/astutil"
+)
 
 func GenBuildTags(predicate bool) string {
 	return fmt.Sprintf("%s\n\n", BuildDirective(predicate))
@@ -22,24 +26,35 @@ func GenTmpBuildTags(predicate bool) string {
 	return fmt.Sprintf("%s\n\n", TmpBuildDirective(predicate))
 }
 
-func GenImport(pkgName, pkgPath string) string {
-	if len(pkgName) <= 0 {
-		pkgName = "."
+func Idents(names ...string) []ast.Expr {
+	var ret []ast.Expr
+	for _, n := range names {
+		ret = append(ret, ast.NewIdent(n))
 	}
-	return fmt.Sprintf("import %s \"%s\"\n", pkgName, pkgPath)
+	return ret
 }
 
-func GenReturn(expr string) string {
-	return fmt.Sprintf("return %s", expr)
+// an empty package name refers to a dot import
+func QualifiedIdent(pkgName, name string) ast.Expr {
+	if len(pkgName) <= 0 {
+		return ast.NewIdent(name)
+	}
+	return &ast.SelectorExpr{X: ast.NewIdent(pkgName), Sel: ast.NewIdent(name)}
 }
 
-func GenFuncLit(funcType string, body string) string {
-	return fmt.Sprintf("%s {\n%s\n}", funcType, body)
+func AssignToken(tok string) token.Token {
+	if tok == token.DEFINE.String() {
+		return token.DEFINE
+	}
+	return token.ASSIGN
 }
 
+// ReplaceBlock replaces the syntax at Old with the New nodes, which are statements,
+// an expression, fields, specs or declarations. With an empty Old the nodes are inserted
+// before the statement starting there, and with no nodes the syntax is removed.
 type ReplaceBlock struct {
 	Old Extent
-	New string
+	New []ast.Node
 }
 
 func ReadExtent(reader io.ReaderAt, extent *Extent) (string, error) {
@@ -66,97 +81,171 @@ func ReadExtentList(reader io.ReaderAt, extents []*Extent) ([]string, error) {
 	return ret, nil
 }
 
+type FileEdit func(src *Source, addImports map[string]string) ([]*ReplaceBlock, error)
+
+func (b *ReplaceBlock) overlaps(other *ReplaceBlock) bool {
+	start, end := b.Old.Start.Offset, b.Old.End.Offset
+	otherStart, otherEnd := other.Old.Start.Offset, other.Old.End.Offset
+	switch {
+	case start == end && otherStart == otherEnd:
+		return start == otherStart
+	case start == end:
+		return otherStart < start && start < otherEnd
+	case otherStart == otherEnd:
+		return start < otherStart && otherStart < end
+	}
+	return start < otherEnd && otherStart < end
+}
+
+// edits are applied in order, those overlapping an earlier one are left for the next pass
+func composeEdits(src *Source, imports map[string]string, edits []*syntaxEdit) ([]*ReplaceBlock, map[*ReplaceBlock]string, map[string]string, error) {
+	addImports := maps.Clone(imports)
+	var blocks []*ReplaceBlock
+	syntaxes := make(map[*ReplaceBlock]string)
+	for _, edit := range edits {
+		editImports := maps.Clone(imports)
+		editBlocks, err := edit.edit(src, editImports)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if slices.ContainsFunc(editBlocks, func(b *ReplaceBlock) bool {
+			return slices.ContainsFunc(blocks, b.overlaps)
+		}) {
+			continue
+		}
+		blocks = append(blocks, editBlocks...)
+		for _, b := range editBlocks {
+			syntaxes[b] = edit.syntax
+		}
+		for p, n := range editImports {
+			if _, ok := imports[p]; !ok {
+				addImports[p] = n
+			}
+		}
+		for p := range imports {
+			if _, ok := editImports[p]; !ok {
+				delete(addImports, p)
+			}
+		}
+	}
+	return blocks, syntaxes, addImports, nil
+}
+
 func GenerateSyntax[Syntax interface {
 	fmt.Stringer
 	comparable
 }](info *FileInfo[Syntax], writer io.Writer,
-	proc func(file *os.File, addImports map[string]string) ([]*ReplaceBlock, error)) error {
-	file, err := os.Open(info.Path)
+	proc func(src *Source, addImports map[string]string) ([]*ReplaceBlock, error)) error {
+	_, err := writeEdits(info.Path, info.BuildTag, info.Imports, writer, []*syntaxEdit{{edit: proc}})
+	return err
+}
+
+// writeEdits returns where the applied replacements are in the source, to be related to
+// the generated code once it is formatted
+func writeEdits(filePath string, buildTag *Extent, imports map[string]string, writer io.Writer, edits []*syntaxEdit) ([]EditMapping, error) {
+	src, err := ParseSource(filePath)
 	if err != nil {
-		return fmt.Errorf("os.Open() failed: %w", err)
+		return nil, err
 	}
-	defer file.Close()
 
-	addImports := make(map[string]string)
-	for p, n := range info.Imports {
+	baseImports := make(map[string]string)
+	for p, n := range imports {
 		if path.Base(p) == n {
 			n = " "
 		}
-		addImports[p] = n
+		baseImports[p] = n
 	}
-	blocks, err := proc(file, addImports)
+	blocks, syntaxes, addImports, err := composeEdits(src, baseImports, edits)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	var mappings []EditMapping
+	for _, b := range blocks {
+		name, original := src.originalRange(&b.Old)
+		mappings = append(mappings, EditMapping{Syntax: syntaxes[b], Source: name, Original: original, Insertion: b.Old.Start.Offset == b.Old.End.Offset})
+	}
+	if err := src.apply(blocks); err != nil {
+		return nil, err
 	}
 
-	slices.SortFunc(blocks, func(a, b *ReplaceBlock) int {
-		return a.Old.Start.Offset - b.Old.Start.Offset
-	})
-
-	if _, err := writer.Write([]byte(GenTmpBuildTags(true))); err != nil {
-		return fmt.Errorf("writer.Write() failed: %w", err)
+	for p, n := range addImports {
+		if _, ok := baseImports[p]; ok {
+			continue
+		}
+		switch n {
+		case " ", path.Base(p):
+			astutil.AddImport(src.Fset, src.File, p)
+		case "":
+			astutil.AddNamedImport(src.Fset, src.File, ".", p)
+		default:
+			astutil.AddNamedImport(src.Fset, src.File, n, p)
+		}
 	}
-	nextOffset := int64(info.ImportExtent.Start.Offset)
-	if info.BuildTag != nil {
-		_, err := file.Seek(int64(info.BuildTag.End.Offset+2), io.SeekStart)
+	var removed []*ast.ImportSpec
+	for _, spec := range src.File.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
 		if err != nil {
-			return fmt.Errorf("file.Seek() failed: %w", err)
+			return nil, fmt.Errorf("strconv.Unquote() failed: %w", err)
+		}
+		if _, ok := addImports[p]; !ok {
+			removed = append(removed, spec)
 		}
-		nextOffset = int64(info.ImportExtent.Start.Offset - info.BuildTag.End.Offset - 1)
 	}
-	if _, err := io.CopyN(writer, file, nextOffset); err != nil {
-		return fmt.Errorf("io.CopyN() failed: %w", err)
+	for _, spec := range removed {
+		var name string
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		p, _ := strconv.Unquote(spec.Path.Value)
+		astutil.DeleteNamedImport(src.Fset, src.File, name, p)
 	}
-	if _, err := file.Seek(int64(info.ImportExtent.End.Offset+1), io.SeekStart); err != nil {
-		return fmt.Errorf("file.Seek() failed: %w", err)
+	for _, decl := range src.File.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT && len(gen.Specs) == 1 {
+			if spec := gen.Specs[0].(*ast.ImportSpec); spec.Doc == nil && spec.Comment == nil {
+				gen.Lparen = token.NoPos
+			}
+		}
 	}
-	var importPaths []string
-	for p := range addImports {
-		importPaths = append(importPaths, p)
+
+	if buildTag != nil {
+		src.removeComment(buildTag)
 	}
-	slices.SortFunc(importPaths, func(a, b string) int {
-		if len(a) == len(b) {
-			return strings.Compare(a, b)
-		}
-		return len(a) - len(b)
-	})
-	for _, p := range importPaths {
-		n := addImports[p]
-		if _, err := writer.Write([]byte(GenNewLine() + GenImport(n, p))); err != nil {
-			return fmt.Errorf("writer.Write() failed: %w", err)
-		}
+	buf := bytes.NewBufferString(GenTmpBuildTags(true))
+	if err := sourcePrintConfig.Fprint(buf, src.Fset, src.File); err != nil {
+		return nil, fmt.Errorf("printer.Fprint() failed: %w", err)
 	}
-	lastOffset := info.ImportExtent.End.Offset + 1
-	for _, b := range blocks {
-		if _, err := io.CopyN(writer, file, int64(b.Old.Start.Offset-lastOffset)); err != nil {
-			return fmt.Errorf("io.CopyN() failed: %w", err)
-		}
-		if _, err := writer.Write([]byte(b.New)); err != nil {
-			return fmt.Errorf("writer.Write() failed: %w", err)
-		}
-		if _, err := file.Seek(int64(b.Old.End.Offset-b.Old.Start.Offset), 1); err != nil {
-			return fmt.Errorf("file.Seek() failed: %w", err)
-		}
-		lastOffset = b.Old.End.Offset
+	content, err := src.lines.directives(buf.Bytes())
+	if err != nil {
+		return nil, err
 	}
-	if _, err := io.Copy(writer, file); err != nil {
-		return fmt.Errorf("io.Copy() failed: %w", err)
+	if _, err := writer.Write(content); err != nil {
+		return nil, fmt.Errorf("writer.Write() failed: %w", err)
 	}
-	return nil
+	return mappings, nil
 }
 
-func replaceBuildTags(tags map[string]*Extent, old string, new string) error {
+func replaceBuildTags(manifest *Manifest, tags map[string]*Extent, old string, new string) error {
 	for file := range tags {
 		if old == prodBuildTag && strings.HasSuffix(file, old+".go") {
 			if err := os.Remove(file); err != nil {
 				return fmt.Errorf("os.Remove(): %w", err)
 			}
+			if err := os.Remove(PositionMapFile(file)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("os.Remove(): %w", err)
+			}
 			continue
 		}
 		content, err := os.ReadFile(file)
 		if err != nil {
 			return fmt.Errorf("os.ReadFile(): %w", err)
 		}
+		if old == prodBuildTag {
+			if line := string(content[tags[file].Start.Offset:tags[file].End.Offset]); strings.Contains(line, old) {
+				manifest.SetDirective(file, line)
+			}
+		} else {
+			manifest.RemoveDirective(file)
+		}
 		content = bytes.Replace(content, []byte(old), []byte(new), 1)
 		if err := os.WriteFile(file, content, 0644); err != nil {
 			return fmt.Errorf("os.WriteFile() %w", err)
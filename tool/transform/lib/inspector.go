@@ -32,6 +32,8 @@ func TmpBuildDirective(predicate bool) string {
 	return fmt.Sprintf("//go:build %s%s", op, tmpBuildTag)
 }
 
+// SyntaxInspector lists the node types to visit and returns the syntax found at a
+// node, or the zero value if the node does not use it.
 type SyntaxInspector[Syntax interface {
 	fmt.Stringer
 	comparable
@@ -68,6 +70,7 @@ type PackageInspector[Syntax interface {
 	imports       map[string]map[string]string
 	importExtents map[string]*Extent
 	buildTags     map[string]*Extent
+	diagnostics   Diagnostics
 
 	inspector SyntaxInspector[Syntax]
 }
@@ -84,7 +87,8 @@ func NewPackageInspector[Syntax interface {
 			buildTags[k] = v
 		}
 		specs := make(map[string]string)
-		pkgEndPos := pkg.Fset.Position(file.Name.End())
+		// files are keyed by their own names rather than those of //line directives
+		pkgEndPos := pkg.Fset.PositionFor(file.Name.End(), false)
 		importExtents[pkgEndPos.Filename] = &Extent{
 			Start: pkgEndPos,
 			End:   pkgEndPos,
@@ -100,7 +104,7 @@ func NewPackageInspector[Syntax interface {
 			}
 			specs[importPath] = importName
 		}
-		fileName := pkg.Fset.Position(file.Pos()).Filename
+		fileName := pkg.Fset.PositionFor(file.Pos(), false).Filename
 		imports[fileName] = specs
 	}
 	return &PackageInspector[Syntax]{
@@ -132,7 +136,7 @@ func (i *PackageInspector[Syntax]) Inspect() []*FileInfo[Syntax] {
 	}, func(n ast.Node, _ bool) bool {
 		node, ok := n.(*ast.GenDecl)
 		if ok && node.Tok == token.IMPORT {
-			end := i.pkg.Fset.Position(node.End())
+			end := i.pkg.Fset.PositionFor(node.End(), false)
 			extent := i.importExtents[end.Filename]
 			if extent.End.Offset < end.Offset {
 				extent.End = end
@@ -148,7 +152,7 @@ func (i *PackageInspector[Syntax]) Inspect() []*FileInfo[Syntax] {
 			syntax := i.inspector.Inspect(node, stack)
 			var zero Syntax
 			if syntax != zero {
-				fileName := i.pkg.Fset.Position(node.Pos()).Filename
+				fileName := i.pkg.Fset.PositionFor(node.Pos(), false).Filename
 				file := fileMap[fileName]
 				if file == nil {
 					file = &FileInfo[Syntax]{
@@ -164,6 +168,9 @@ func (i *PackageInspector[Syntax]) Inspect() []*FileInfo[Syntax] {
 			}
 			return true
 		})
+	if reporter, ok := i.inspector.(DiagnosticReporter); ok {
+		i.diagnostics = reporter.Diagnostics()
+	}
 	var ret []*FileInfo[Syntax]
 	for _, f := range fileMap {
 		if extent, ok := i.buildTags[f.Path]; ok {
@@ -174,6 +181,10 @@ func (i *PackageInspector[Syntax]) Inspect() []*FileInfo[Syntax] {
 	return ret
 }
 
+func (i *PackageInspector[Syntax]) Diagnostics() Diagnostics {
+	return i.diagnostics
+}
+
 func FindFileBuildTags(pkg *packages.Package, file *ast.File) map[string]*Extent {
 	buildTags := make(map[string]*Extent)
 	for _, cg := range file.Comments {
@@ -182,10 +193,10 @@ func FindFileBuildTags(pkg *packages.Package, file *ast.File) map[string]*Extent
 				strings.Contains(c.Text, BuildDirective(false)) ||
 				strings.Contains(c.Text, TmpBuildDirective(true)) ||
 				strings.Contains(c.Text, BuildDirective(true)) {
-				fileName := pkg.Fset.Position(c.Pos()).Filename
+				fileName := pkg.Fset.PositionFor(c.Pos(), false).Filename
 				buildTags[fileName] = &Extent{
-					Start: pkg.Fset.Position(c.Pos()),
-					End:   pkg.Fset.Position(c.End()),
+					Start: pkg.Fset.PositionFor(c.Pos(), false),
+					End:   pkg.Fset.PositionFor(c.End(), false),
 				}
 			}
 		}
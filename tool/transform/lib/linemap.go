@@ -0,0 +1,196 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// lineMap relates a file stripped of its //line directives to the positions they
+// adjusted, so that the directives of a file generated in an earlier pass are carried
+// over to the next one.
+type lineMap struct {
+	// the raw bytes removed at clean offsets, in order
+	removed []removedLines
+	// source positions of the clean lines, nil when the file had no directives
+	lines []token.Position
+	name  string
+}
+
+type removedLines struct {
+	at, size int
+}
+
+func stripLineDirectives(name string, content []byte) ([]byte, *lineMap, error) {
+	m := &lineMap{name: name}
+	if !bytes.HasPrefix(content, []byte("//line ")) && !bytes.Contains(content, []byte("\n//line ")) {
+		return content, m, nil
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, name, content, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parser.ParseFile() failed: %w", err)
+	}
+	tokFile := fset.File(file.Pos())
+	directives := make(map[int]bool)
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			if pos := tokFile.PositionFor(c.Pos(), false); pos.Column == 1 && strings.HasPrefix(c.Text, "//line ") {
+				directives[pos.Line] = true
+			}
+		}
+	}
+
+	var clean []byte
+	var adjusted bool
+	for idx, line := range bytes.SplitAfter(content, []byte("\n")) {
+		rawLine := idx + 1
+		if directives[rawLine] {
+			m.removed = append(m.removed, removedLines{at: len(clean), size: len(line)})
+			adjusted = true
+		} else if len(line) > 0 {
+			clean = append(clean, line...)
+			// lines before the first directive have no source
+			var pos token.Position
+			if adjusted {
+				pos = tokFile.PositionFor(tokFile.LineStart(rawLine), true)
+			}
+			m.lines = append(m.lines, token.Position{Filename: pos.Filename, Line: pos.Line})
+		}
+	}
+	return clean, m, nil
+}
+
+// raw returns the offset in the original content of a clean one.
+func (m *lineMap) raw(offset int) int {
+	ret := offset
+	for _, r := range m.removed {
+		if r.at > offset {
+			break
+		}
+		ret += r.size
+	}
+	return ret
+}
+
+// clean is the inverse of raw, offsets inside removed lines map to the line after them.
+func (m *lineMap) clean(offset int) int {
+	var removed int
+	for _, r := range m.removed {
+		start := r.at + removed
+		if offset < start {
+			break
+		}
+		if offset < start+r.size {
+			return r.at
+		}
+		removed += r.size
+	}
+	return offset - removed
+}
+
+func (m *lineMap) position(line int) token.Position {
+	if m.lines == nil || line <= 0 {
+		return token.Position{Filename: m.name, Line: line}
+	}
+	if line > len(m.lines) {
+		last := m.lines[len(m.lines)-1]
+		return token.Position{Filename: last.Filename, Line: last.Line + line - len(m.lines)}
+	}
+	return m.lines[line-1]
+}
+
+// directives rewrites the //line directives of a file printed from the clean one, so
+// that they refer to the source positions. None are left in the import block, since
+// goimports rewrites it later on, but one follows it to hold however many lines it takes.
+func (m *lineMap) directives(printed []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", printed, parser.ImportsOnly)
+	if err != nil {
+		return nil, fmt.Errorf("parser.ParseFile() failed: %w", err)
+	}
+	var importsEnd int
+	if len(file.Decls) > 0 {
+		importsEnd = fset.PositionFor(file.Decls[len(file.Decls)-1].End(), false).Line
+	}
+	// a directive cannot be put into a multi-line raw string
+	inString := make(map[int]bool)
+	var s scanner.Scanner
+	s.Init(fset.AddFile("", -1, len(printed)), printed, nil, 0)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.STRING {
+			start := fset.PositionFor(pos, false).Line
+			for line := start + 1; line <= start+strings.Count(lit, "\n"); line++ {
+				inString[line] = true
+			}
+		}
+	}
+
+	var ret [][]byte
+	// the clean line of the next printed line, unknown before the first directive
+	var cleanLine int
+	var next token.Position
+	var anchored bool
+	// the blank line before the first one after the imports, which comments are anchored at
+	blank := -1
+	var blankPos token.Position
+	for idx, line := range bytes.SplitAfter(printed, []byte("\n")) {
+		if n, ok := parseLineDirective(line); ok {
+			cleanLine = n
+			continue
+		}
+		if len(line) <= 0 || cleanLine <= 0 {
+			ret = append(ret, line)
+			continue
+		}
+		pos := m.position(cleanLine)
+		cleanLine++
+		printedLine := idx + 1
+		text := bytes.TrimSpace(line)
+		// blank and comment lines need no position, and gofmt moves directives to the
+		// end of doc comments
+		comment := len(text) <= 0 || bytes.HasPrefix(text, []byte("//"))
+		switch {
+		case printedLine <= importsEnd || inString[printedLine] || len(pos.Filename) <= 0:
+		case !anchored && len(text) <= 0:
+			blank, blankPos = len(ret), pos
+		case !anchored && comment && blank >= 0:
+			ret = slices.Insert(ret, blank, []byte(fmt.Sprintf("//line %s:%d\n", blankPos.Filename, blankPos.Line)))
+			anchored = true
+			next = token.Position{Filename: blankPos.Filename, Line: blankPos.Line + len(ret) - blank - 1}
+		case anchored && (pos == next || comment):
+		default:
+			ret = append(ret, []byte(fmt.Sprintf("//line %s:%d\n", pos.Filename, pos.Line)))
+			anchored = true
+			next = pos
+		}
+		next.Line++
+		ret = append(ret, line)
+	}
+	return bytes.Join(ret, nil), nil
+}
+
+func parseLineDirective(line []byte) (int, bool) {
+	text, ok := strings.CutPrefix(strings.TrimRight(string(line), "\r\n"), "//line ")
+	if !ok {
+		return 0, false
+	}
+	colon := strings.LastIndex(text, ":")
+	if colon <= 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(text[colon+1:])
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
@@ -3,14 +3,13 @@ package lib
 import (
 	"context"
 	"fmt"
-	"log"
 	"os"
 
 	"golang.org/x/tools/go/packages"
 )
 
-func LoadPackages(ctx context.Context, path string, buildFlags ...string) ([]*packages.Package, error) {
-	cfg := &packages.Config{
+func LoadPackages(ctx context.Context, cfg *Config, buildTags ...string) ([]*packages.Package, error) {
+	loadCfg := &packages.Config{
 		Mode: packages.NeedName |
 			packages.NeedFiles |
 			packages.NeedImports |
@@ -20,12 +19,11 @@ func LoadPackages(ctx context.Context, path string, buildFlags ...string) ([]*pa
 			packages.NeedTypesInfo |
 			packages.NeedModule,
 		Context:    ctx,
-		Logf:       log.Printf,
-		Dir:        path,
+		Dir:        cfg.RootDir,
 		Env:        os.Environ(),
-		BuildFlags: buildFlags,
+		BuildFlags: cfg.buildFlags(buildTags...),
 	}
-	pkgs, err := packages.Load(cfg, "./...")
+	pkgs, err := packages.Load(loadCfg, cfg.patterns()...)
 	if err != nil {
 		return nil, fmt.Errorf("packages.Load() failed: %w", err)
 	}
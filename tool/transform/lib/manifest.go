@@ -0,0 +1,176 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+const ManifestFile = ".sugar-manifest.json"
+
+type Manifest struct {
+	Generated []string `json:"generated"`
+	Tagged    []string `json:"tagged"`
+	// the original directive line of each file whose tags were rewritten
+	Directives map[string]string `json:"directives,omitempty"`
+
+	rootDir string
+	mu      sync.Mutex
+}
+
+func LoadManifest(rootDir string) (*Manifest, error) {
+	rootDir, err := filepath.Abs(rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Abs() failed: %w", err)
+	}
+	m := &Manifest{rootDir: rootDir}
+	content, err := os.ReadFile(filepath.Join(rootDir, ManifestFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return m, nil
+		}
+		return nil, fmt.Errorf("os.ReadFile() failed: %w", err)
+	}
+	if err := json.Unmarshal(content, m); err != nil {
+		return nil, fmt.Errorf("parse %s failed: %w", ManifestFile, err)
+	}
+	slices.Sort(m.Generated)
+	slices.Sort(m.Tagged)
+	return m, nil
+}
+
+func (m *Manifest) rel(path string) string {
+	if rel, err := filepath.Rel(m.rootDir, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(path)
+}
+
+func addPath(paths []string, path string) []string {
+	if idx, found := slices.BinarySearch(paths, path); !found {
+		paths = slices.Insert(paths, idx, path)
+	}
+	return paths
+}
+
+func removePath(paths []string, path string) []string {
+	if idx, found := slices.BinarySearch(paths, path); found {
+		paths = slices.Delete(paths, idx, idx+1)
+	}
+	return paths
+}
+
+func (m *Manifest) AddGenerated(path string) {
+	if m != nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.Generated = addPath(m.Generated, m.rel(path))
+	}
+}
+
+func (m *Manifest) RemoveGenerated(path string) {
+	if m != nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.Generated = removePath(m.Generated, m.rel(path))
+	}
+}
+
+func (m *Manifest) AddTagged(path string) {
+	if m != nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.Tagged = addPath(m.Tagged, m.rel(path))
+	}
+}
+
+func (m *Manifest) RemoveTagged(path string) {
+	if m != nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.Tagged = removePath(m.Tagged, m.rel(path))
+	}
+}
+
+func (m *Manifest) IsTagged(path string) bool {
+	if m == nil {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, found := slices.BinarySearch(m.Tagged, m.rel(path))
+	return found
+}
+
+func (m *Manifest) SetDirective(path string, line string) {
+	if m != nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.Directives == nil {
+			m.Directives = make(map[string]string)
+		}
+		// an interrupted run leaves the rewritten line, which is not the original one
+		if _, ok := m.Directives[m.rel(path)]; !ok {
+			m.Directives[m.rel(path)] = line
+		}
+	}
+}
+
+func (m *Manifest) RemoveDirective(path string) {
+	if m != nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.Directives, m.rel(path))
+	}
+}
+
+func (m *Manifest) Directive(path string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	line, ok := m.Directives[m.rel(path)]
+	return line, ok
+}
+
+func (m *Manifest) existing(paths []string) []string {
+	var ret []string
+	for _, p := range paths {
+		if _, err := os.Stat(filepath.Join(m.rootDir, filepath.FromSlash(p))); err == nil {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+func (m *Manifest) Save() error {
+	m.Generated = m.existing(m.Generated)
+	m.Tagged = m.existing(m.Tagged)
+	for _, p := range slices.Collect(maps.Keys(m.Directives)) {
+		if len(m.existing([]string{p})) <= 0 {
+			delete(m.Directives, p)
+		}
+	}
+	path := filepath.Join(m.rootDir, ManifestFile)
+	if len(m.Generated) <= 0 && len(m.Tagged) <= 0 && len(m.Directives) <= 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("os.Remove() failed: %w", err)
+		}
+		return nil
+	}
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent() failed: %w", err)
+	}
+	if err := os.WriteFile(path, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("os.WriteFile() failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "b.go", "b_sugar_production.go"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("package m\n"), 0644); err != nil {
+			t.Fatalf("os.WriteFile() failed: %v", err)
+		}
+	}
+
+	m, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("LoadManifest() failed: %v", err)
+	}
+	m.AddGenerated(filepath.Join(dir, "b_sugar_production.go"))
+	m.AddGenerated(filepath.Join(dir, "gone_sugar_production.go"))
+	m.AddTagged(filepath.Join(dir, "b.go"))
+	m.SetDirective(filepath.Join(dir, "a.go"), "//go:build !sugar_production")
+	m.SetDirective(filepath.Join(dir, "a.go"), "//go:build !sugar_temp")
+	m.SetDirective(filepath.Join(dir, "gone.go"), "//go:build !sugar_production")
+	if err := m.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	loaded, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("LoadManifest() failed: %v", err)
+	}
+	if want := []string{"b_sugar_production.go"}; !slices.Equal(loaded.Generated, want) {
+		t.Errorf("got generated %v, want %v", loaded.Generated, want)
+	}
+	tests := []struct {
+		file         string
+		tagged       bool
+		directive    string
+		hasDirective bool
+	}{
+		{file: "a.go", directive: "//go:build !sugar_production", hasDirective: true},
+		{file: "b.go", tagged: true},
+		{file: "gone.go"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.file)
+		if got := loaded.IsTagged(path); got != tt.tagged {
+			t.Errorf("%s: got tagged %t, want %t", tt.file, got, tt.tagged)
+		}
+		if got, ok := loaded.Directive(path); got != tt.directive || ok != tt.hasDirective {
+			t.Errorf("%s: got directive %q, %t, want %q, %t", tt.file, got, ok, tt.directive, tt.hasDirective)
+		}
+	}
+
+	loaded.RemoveGenerated(filepath.Join(dir, "b_sugar_production.go"))
+	loaded.RemoveTagged(filepath.Join(dir, "b.go"))
+	loaded.RemoveDirective(filepath.Join(dir, "a.go"))
+	if err := loaded.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ManifestFile)); !os.IsNotExist(err) {
+		t.Errorf("an empty manifest was kept: %v", err)
+	}
+}
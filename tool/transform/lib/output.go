@@ -0,0 +1,226 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+const outputMarkerFile = ".sugar-output"
+
+func findModuleRoot(dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d
+		}
+		if filepath.Dir(d) == d {
+			return dir
+		}
+	}
+}
+
+func prepareOutputDir(dstDir string) error {
+	entries, err := os.ReadDir(dstDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return os.MkdirAll(dstDir, 0755)
+		}
+		return fmt.Errorf("os.ReadDir() failed: %w", err)
+	}
+	if len(entries) <= 0 {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, outputMarkerFile)); err != nil {
+		return fmt.Errorf("output directory %s is not empty and was not written by this tool", dstDir)
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(dstDir, e.Name())); err != nil {
+			return fmt.Errorf("os.RemoveAll() failed: %w", err)
+		}
+	}
+	return nil
+}
+
+func rewriteGoMod(srcModRoot string, dstModRoot string) error {
+	path := filepath.Join(dstModRoot, "go.mod")
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("os.ReadFile() failed: %w", err)
+	}
+	file, err := modfile.Parse(path, content, nil)
+	if err != nil {
+		return fmt.Errorf("modfile.Parse() failed: %w", err)
+	}
+	var changed bool
+	for _, r := range file.Replace {
+		if len(r.New.Version) > 0 || filepath.IsAbs(r.New.Path) {
+			continue
+		}
+		target := filepath.Join(srcModRoot, r.New.Path)
+		if target == filepath.Join(dstModRoot, r.New.Path) {
+			continue
+		}
+		if err := file.AddReplace(r.Old.Path, r.Old.Version, target, ""); err != nil {
+			return fmt.Errorf("AddReplace() failed: %w", err)
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	content, err = file.Format()
+	if err != nil {
+		return fmt.Errorf("Format() failed: %w", err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("os.WriteFile() failed: %w", err)
+	}
+	return nil
+}
+
+func CopyModule(rootDir string, dstDir string) (string, error) {
+	rootDir, err := filepath.Abs(rootDir)
+	if err != nil {
+		return "", fmt.Errorf("filepath.Abs() failed: %w", err)
+	}
+	dstDir, err = filepath.Abs(dstDir)
+	if err != nil {
+		return "", fmt.Errorf("filepath.Abs() failed: %w", err)
+	}
+	modRoot := findModuleRoot(rootDir)
+	if inside, err := filepath.Rel(modRoot, dstDir); err == nil &&
+		(inside == "." || !strings.HasPrefix(inside, "..")) {
+		return "", fmt.Errorf("output directory %s must not be inside module %s", dstDir, modRoot)
+	}
+	rel, err := filepath.Rel(modRoot, rootDir)
+	if err != nil {
+		return "", fmt.Errorf("filepath.Rel() failed: %w", err)
+	}
+	if err := prepareOutputDir(dstDir); err != nil {
+		return "", fmt.Errorf("prepareOutputDir() failed: %w", err)
+	}
+	if err := CopyTree(modRoot, dstDir); err != nil {
+		return "", fmt.Errorf("CopyTree() failed: %w", err)
+	}
+	if err := rewriteGoMod(modRoot, dstDir); err != nil {
+		return "", fmt.Errorf("rewriteGoMod() failed: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dstDir, outputMarkerFile), nil, 0644); err != nil {
+		return "", fmt.Errorf("os.WriteFile() failed: %w", err)
+	}
+	return filepath.Join(dstDir, rel), nil
+}
+
+// mirrorPackage prepares dstDir for transforming the package at pkgDir alone: the files of the
+// package and the go.mod of its module are copied, and the rest of the module is linked, so the
+// package still loads with the other packages of the module.
+func mirrorPackage(pkgDir string, dstDir string) (string, error) {
+	pkgDir, err := filepath.Abs(pkgDir)
+	if err != nil {
+		return "", fmt.Errorf("filepath.Abs() failed: %w", err)
+	}
+	dstDir, err = filepath.Abs(dstDir)
+	if err != nil {
+		return "", fmt.Errorf("filepath.Abs() failed: %w", err)
+	}
+	modRoot := findModuleRoot(pkgDir)
+	rel, err := filepath.Rel(modRoot, pkgDir)
+	if err != nil {
+		return "", fmt.Errorf("filepath.Rel() failed: %w", err)
+	}
+	if err := prepareOutputDir(dstDir); err != nil {
+		return "", fmt.Errorf("prepareOutputDir() failed: %w", err)
+	}
+	if err := mirrorDir(modRoot, dstDir, modRoot, pkgDir); err != nil {
+		return "", err
+	}
+	if err := rewriteGoMod(modRoot, dstDir); err != nil {
+		return "", fmt.Errorf("rewriteGoMod() failed: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dstDir, outputMarkerFile), nil, 0644); err != nil {
+		return "", fmt.Errorf("os.WriteFile() failed: %w", err)
+	}
+	return filepath.Join(dstDir, rel), nil
+}
+
+func mirrorDir(src string, dst string, modRoot string, pkgDir string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("os.ReadDir() failed: %w", err)
+	}
+	for _, e := range entries {
+		path, target := filepath.Join(src, e.Name()), filepath.Join(dst, e.Name())
+		switch {
+		case e.IsDir() && (path == pkgDir || strings.HasPrefix(pkgDir, path+string(filepath.Separator))):
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("os.MkdirAll() failed: %w", err)
+			}
+			if err := mirrorDir(path, target, modRoot, pkgDir); err != nil {
+				return err
+			}
+		case e.Type().IsRegular() && (src == pkgDir || src == modRoot && e.Name() == "go.mod"):
+			if err := copyFile(path, target); err != nil {
+				return fmt.Errorf("copyFile() failed: %w", err)
+			}
+		default:
+			if err := os.Symlink(path, target); err != nil {
+				return fmt.Errorf("os.Symlink() failed: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func OutOfTree(ctx context.Context, rootDir string, dstDir string, run func(ctx context.Context, rootDir string) error) (string, error) {
+	return outOfTree(ctx, rootDir, dstDir, CopyModule, run)
+}
+
+// PackageOutOfTree is OutOfTree for the package at pkgDir alone, which is the only part of
+// its module copied into dstDir.
+func PackageOutOfTree(ctx context.Context, pkgDir string, dstDir string, run func(ctx context.Context, rootDir string) error) (string, error) {
+	return outOfTree(ctx, pkgDir, dstDir, mirrorPackage, run)
+}
+
+func outOfTree(ctx context.Context, rootDir string, dstDir string,
+	copyTree func(rootDir string, dstDir string) (string, error),
+	run func(ctx context.Context, rootDir string) error,
+) (string, error) {
+	rootDir, err := filepath.Abs(rootDir)
+	if err != nil {
+		return "", fmt.Errorf("filepath.Abs() failed: %w", err)
+	}
+	dstDir, err = filepath.Abs(dstDir)
+	if err != nil {
+		return "", fmt.Errorf("filepath.Abs() failed: %w", err)
+	}
+	dstRoot, err := copyTree(rootDir, dstDir)
+	if err != nil {
+		return "", fmt.Errorf("copy %s failed: %w", rootDir, err)
+	}
+
+	runErr := run(ctx, dstRoot)
+	var diags Diagnostics
+	if errors.As(runErr, &diags) {
+		for _, d := range diags {
+			if path, err := filepath.Rel(dstRoot, d.Pos.Filename); err == nil {
+				d.Pos.Filename = filepath.Join(rootDir, path)
+			}
+		}
+	} else if runErr != nil {
+		return "", runErr
+	}
+
+	// generated code may embed source paths, e.g. predefined File__
+	if err := rewriteTree(dstRoot, dstDir, findModuleRoot(rootDir)); err != nil {
+		return "", fmt.Errorf("rewriteTree() failed: %w", err)
+	}
+	return dstRoot, runErr
+}
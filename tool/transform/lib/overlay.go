@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func ProductionFileName(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "_" + prodBuildTag + ext
+}
+
+func IsProductionFile(path string) bool {
+	return strings.HasSuffix(path, "_"+prodBuildTag+".go")
+}
+
+func StripBuildDirective(content []byte) []byte {
+	// blank out the directive but keep line numbers, so the code builds without the tag
+	return bytes.Replace(content, []byte(BuildDirective(true)), nil, 1)
+}
+
+// SubstituteSource turns a generated file into the content compiled in place of its source
+// file. The //line directives then name the source by its path, and skip the build
+// directive that the copy it was generated from had prepended if the source has none.
+func SubstituteSource(content []byte, source string) ([]byte, error) {
+	src, err := os.ReadFile(source)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile() failed: %w", err)
+	}
+	var shift int
+	if !bytes.Contains(src, []byte(BuildDirective(false))) && !bytes.Contains(src, []byte(TmpBuildDirective(false))) {
+		shift = strings.Count(GenTmpBuildTags(false), "\n")
+	}
+	lines := bytes.SplitAfter(StripBuildDirective(content), []byte("\n"))
+	for idx, line := range lines {
+		n, ok := parseLineDirective(line)
+		if !ok {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(string(line), "//line "), fmt.Sprintf(":%d\n", n))
+		if filepath.IsAbs(name) {
+			continue
+		}
+		if name == filepath.Base(source) {
+			n = max(n-shift, 1)
+		}
+		lines[idx] = []byte(fmt.Sprintf("//line %s:%d\n", filepath.Join(filepath.Dir(source), name), n))
+	}
+	return bytes.Join(lines, nil), nil
+}
+
+type Overlay struct {
+	Replace map[string]string
+}
+
+func DefaultOverlayCacheDir(rootDir string) (string, error) {
+	rootDir, err := filepath.Abs(rootDir)
+	if err != nil {
+		return "", fmt.Errorf("filepath.Abs() failed: %w", err)
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("os.UserCacheDir() failed: %w", err)
+	}
+	sum := sha256.Sum256([]byte(findModuleRoot(rootDir)))
+	return filepath.Join(cacheDir, "sugar", "overlay", hex.EncodeToString(sum[:8])), nil
+}
+
+func BuildOverlay(ctx context.Context, rootDir string, cacheDir string, run func(ctx context.Context, rootDir string) error) (*Overlay, error) {
+	rootDir, err := filepath.Abs(rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Abs() failed: %w", err)
+	}
+	cacheDir, err = filepath.Abs(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Abs() failed: %w", err)
+	}
+	filesDir := filepath.Join(cacheDir, "files")
+
+	dstRoot, runErr := OutOfTree(ctx, rootDir, filepath.Join(cacheDir, "module"), run)
+	var diags Diagnostics
+	if runErr != nil && !errors.As(runErr, &diags) {
+		return nil, runErr
+	}
+	if err := os.RemoveAll(filesDir); err != nil {
+		return nil, fmt.Errorf("os.RemoveAll() failed: %w", err)
+	}
+
+	overlay := &Overlay{Replace: make(map[string]string)}
+	err = filepath.WalkDir(dstRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if skipDir(d) {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() || !IsProductionFile(path) {
+			return nil
+		}
+		rel, err := filepath.Rel(dstRoot, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel() failed: %w", err)
+		}
+		rel = strings.TrimSuffix(rel, "_"+prodBuildTag+".go") + ".go"
+		source := filepath.Join(rootDir, rel)
+		if _, err := os.Stat(source); err != nil {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("os.ReadFile() failed: %w", err)
+		}
+		content, err = SubstituteSource(content, source)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(filesDir, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("os.MkdirAll() failed: %w", err)
+		}
+		if err := os.WriteFile(target, content, 0644); err != nil {
+			return fmt.Errorf("os.WriteFile() failed: %w", err)
+		}
+		overlay.Replace[source] = target
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("filepath.WalkDir() failed: %w", err)
+	}
+	return overlay, runErr
+}
+
+func (o *Overlay) Save(path string) error {
+	content, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent() failed: %w", err)
+	}
+	if err := os.WriteFile(path, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("os.WriteFile() failed: %w", err)
+	}
+	return nil
+}
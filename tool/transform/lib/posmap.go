@@ -0,0 +1,221 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+// PositionMap relates the lines of a generated file to the source lines they were
+// generated from, as its //line directives do, and the code generated for each replacement
+// to the source range it replaced. It is saved next to the file when the file is generated,
+// so tools reading positions of the compiled code need not parse it.
+type PositionMap struct {
+	Lines []LineRange   `json:"lines"`
+	Edits []EditMapping `json:"edits,omitempty"`
+}
+
+// LineRange maps Count lines of a generated file starting at Line to the lines of Source,
+// named relative to the directory of the file, starting at SourceLine. The columns of lines
+// copied from the source are shifted by Shift, the other lines stand for the whole source line.
+type LineRange struct {
+	Line       int    `json:"line"`
+	Count      int    `json:"count"`
+	Source     string `json:"source"`
+	SourceLine int    `json:"sourceLine"`
+	Copied     bool   `json:"copied,omitempty"`
+	Shift      int    `json:"shift,omitempty"`
+}
+
+// EditMapping relates the generated ranges of a replacement made for Syntax to the range of
+// Source it replaced, which is empty for insertions. The columns of source ranges are 0 if
+// the replaced code was itself generated, by an earlier pass over the file.
+type EditMapping struct {
+	Syntax    string  `json:"syntax,omitempty"`
+	Source    string  `json:"source"`
+	Original  Range   `json:"original"`
+	Insertion bool    `json:"insertion,omitempty"`
+	Generated []Range `json:"generated"`
+}
+
+// Range spans from the start position to the end one, exclusive, in 1-based lines and byte columns.
+type Range struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+// originalRange returns the source file and range of an extent of s, which is the generated
+// file of an earlier pass if s has //line directives.
+func (s *Source) originalRange(extent *Extent) (string, Range) {
+	position := func(offset int) (token.Position, int) {
+		pos := s.tokFile.Position(s.tokFile.Pos(s.lines.clean(offset)))
+		return s.lines.position(pos.Line), pos.Column
+	}
+	start, startCol := position(extent.Start.Offset)
+	end, endCol := position(extent.End.Offset)
+	if s.lines.lines != nil {
+		startCol, endCol = 0, 0
+	}
+	return start.Filename, Range{StartLine: start.Line, StartColumn: startCol, EndLine: end.Line, EndColumn: endCol}
+}
+
+func PositionMapFile(path string) string {
+	return path + ".map"
+}
+
+func indent(line []byte) int {
+	return len(line) - len(bytes.TrimLeft(line, " \t"))
+}
+
+func newPositionMap(path string, edits []EditMapping) (*PositionMap, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile() failed: %w", err)
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filepath.Base(path), content, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("parser.ParseFile() failed: %w", err)
+	}
+	tokFile := fset.File(file.Pos())
+
+	sources := make(map[string][][]byte)
+	sourceLines := func(name string) [][]byte {
+		if lines, ok := sources[name]; ok {
+			return lines
+		}
+		var lines [][]byte
+		if content, err := os.ReadFile(filepath.Join(filepath.Dir(path), name)); err == nil {
+			lines = bytes.Split(content, []byte("\n"))
+		}
+		sources[name] = lines
+		return lines
+	}
+
+	m := &PositionMap{}
+	lines := bytes.Split(content, []byte("\n"))
+	directives := make(map[int]bool)
+	for idx, line := range lines {
+		genLine := idx + 1
+		if genLine > tokFile.LineCount() {
+			break
+		}
+		if _, ok := parseLineDirective(line); ok {
+			directives[genLine] = true
+			continue
+		}
+		// lines before the first directive have no source
+		if len(directives) <= 0 {
+			continue
+		}
+		pos := tokFile.PositionFor(tokFile.LineStart(genLine), true)
+		r := LineRange{Line: genLine, Count: 1, Source: pos.Filename, SourceLine: pos.Line}
+		if lines := sourceLines(pos.Filename); pos.Line <= len(lines) {
+			srcLine := lines[pos.Line-1]
+			if bytes.Equal(bytes.TrimSpace(srcLine), bytes.TrimSpace(line)) {
+				r.Copied, r.Shift = true, indent(srcLine)-indent(line)
+			}
+		}
+		if len(m.Lines) > 0 {
+			last := &m.Lines[len(m.Lines)-1]
+			if last.Line+last.Count == r.Line && last.Source == r.Source && last.SourceLine+last.Count == r.SourceLine &&
+				last.Copied == r.Copied && last.Shift == r.Shift {
+				last.Count++
+				continue
+			}
+		}
+		m.Lines = append(m.Lines, r)
+	}
+
+	// the generated code of a replacement is on the lines mapped into the range it replaced,
+	// apart from the lines copied from the source before which code is inserted
+	for _, e := range edits {
+		var genLines []int
+		for _, r := range m.Lines {
+			if r.Source != e.Source || e.Insertion && r.Copied {
+				continue
+			}
+			for line := max(r.SourceLine, e.Original.StartLine); line <= min(r.SourceLine+r.Count-1, e.Original.EndLine); line++ {
+				if genLine := r.Line + line - r.SourceLine; len(bytes.TrimSpace(lines[genLine-1])) > 0 {
+					genLines = append(genLines, genLine)
+				}
+			}
+		}
+		slices.Sort(genLines)
+		e.Generated = nil
+		for idx, line := range genLines {
+			text := lines[line-1]
+			last := len(e.Generated) - 1
+			if idx > 0 && skippable(lines, directives, genLines[idx-1]+1, line) {
+				e.Generated[last].EndLine, e.Generated[last].EndColumn = line, len(bytes.TrimRight(text, " \t\r"))+1
+				continue
+			}
+			e.Generated = append(e.Generated, Range{
+				StartLine:   line,
+				StartColumn: indent(text) + 1,
+				EndLine:     line,
+				EndColumn:   len(bytes.TrimRight(text, " \t\r")) + 1,
+			})
+		}
+		m.Edits = append(m.Edits, e)
+	}
+	return m, nil
+}
+
+// blank lines and directives between generated lines do not split their range
+func skippable(lines [][]byte, directives map[int]bool, from, to int) bool {
+	for line := from; line < to; line++ {
+		if !directives[line] && len(bytes.TrimSpace(lines[line-1])) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// WritePositionMap saves the position map of the generated file at path, relating the
+// code generated for the edits to their ranges in the source.
+func WritePositionMap(path string, edits []EditMapping) error {
+	m, err := newPositionMap(path, edits)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent() failed: %w", err)
+	}
+	if err := os.WriteFile(PositionMapFile(path), append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("os.WriteFile() failed: %w", err)
+	}
+	return nil
+}
+
+// LoadPositionMap reads the position map saved for the generated file at path.
+func LoadPositionMap(path string) (*PositionMap, error) {
+	content, err := os.ReadFile(PositionMapFile(path))
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile() failed: %w", err)
+	}
+	m := &PositionMap{}
+	if err := json.Unmarshal(content, m); err != nil {
+		return nil, fmt.Errorf("parse %s failed: %w", PositionMapFile(path), err)
+	}
+	return m, nil
+}
+
+func (m *PositionMap) lookup(line int) (*LineRange, bool) {
+	idx := sort.Search(len(m.Lines), func(i int) bool {
+		return m.Lines[i].Line+m.Lines[i].Count > line
+	})
+	if idx >= len(m.Lines) || m.Lines[idx].Line > line {
+		return nil, false
+	}
+	return &m.Lines[idx], true
+}
@@ -0,0 +1,108 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const (
+	posmapSource = `package main
+
+func Double(x int) (int, error) {
+	y := Check(x).Q()
+	return y * 2, nil
+}
+`
+	posmapGenerated = `//go:build sugar_production
+
+package main
+
+//line main.go:3
+func Double(x int) (int, error) {
+	varA, errA := Check(x)
+//line main.go:4
+	if errA != nil {
+//line main.go:4
+		return 0, errA
+//line main.go:4
+	}
+//line main.go:4
+	y := varA
+	return y * 2, nil
+}
+`
+)
+
+// writeGenerated writes a source and the file generated from it with its position map,
+// returning the path of the generated file
+func writeGenerated(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	genFile := filepath.Join(dir, "main_sugar_production.go")
+	for path, content := range map[string]string{filepath.Join(dir, "main.go"): posmapSource, genFile: posmapGenerated} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("os.WriteFile() failed: %v", err)
+		}
+	}
+	edits := []EditMapping{{
+		Syntax:   "question_mark",
+		Source:   "main.go",
+		Original: Range{StartLine: 4, StartColumn: 7, EndLine: 4, EndColumn: 19},
+	}}
+	if err := WritePositionMap(genFile, edits); err != nil {
+		t.Fatalf("WritePositionMap() failed: %v", err)
+	}
+	return genFile
+}
+
+func TestPositionMap(t *testing.T) {
+	m, err := LoadPositionMap(writeGenerated(t))
+	if err != nil {
+		t.Fatalf("LoadPositionMap() failed: %v", err)
+	}
+	want := &PositionMap{
+		Lines: []LineRange{
+			{Line: 6, Count: 1, Source: "main.go", SourceLine: 3, Copied: true},
+			{Line: 7, Count: 1, Source: "main.go", SourceLine: 4},
+			{Line: 9, Count: 1, Source: "main.go", SourceLine: 4},
+			{Line: 11, Count: 1, Source: "main.go", SourceLine: 4},
+			{Line: 13, Count: 1, Source: "main.go", SourceLine: 4},
+			{Line: 15, Count: 1, Source: "main.go", SourceLine: 4},
+			{Line: 16, Count: 2, Source: "main.go", SourceLine: 5, Copied: true},
+		},
+		Edits: []EditMapping{{
+			Syntax:    "question_mark",
+			Source:    "main.go",
+			Original:  Range{StartLine: 4, StartColumn: 7, EndLine: 4, EndColumn: 19},
+			Generated: []Range{{StartLine: 7, StartColumn: 2, EndLine: 15, EndColumn: 11}},
+		}},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got %+v, want %+v", m, want)
+	}
+
+	tests := []struct {
+		line       int
+		sourceLine int
+		ok         bool
+	}{
+		{line: 3},
+		{line: 6, sourceLine: 3, ok: true},
+		{line: 8},
+		{line: 11, sourceLine: 4, ok: true},
+		{line: 17, sourceLine: 5, ok: true},
+		{line: 18},
+	}
+	for _, tt := range tests {
+		r, ok := m.lookup(tt.line)
+		if ok != tt.ok {
+			t.Errorf("line %d: got ok %t, want %t", tt.line, ok, tt.ok)
+			continue
+		}
+		if ok && r.SourceLine != tt.sourceLine {
+			t.Errorf("line %d: got range starting at source line %d, want %d", tt.line, r.SourceLine, tt.sourceLine)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+type registration struct {
+	name    string
+	program Program
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []*registration
+)
+
+// RegisterSyntax makes a syntax available to the transform tool under the given name.
+// Syntaxes run in registration order, which also decides which edit wins when the
+// edits of two syntaxes overlap. It panics if the name is registered twice, so it is
+// meant to be called from an init function or from main before the tool runs.
+func RegisterSyntax(name string, program Program) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if program == nil {
+		panic("lib: RegisterSyntax program is nil")
+	}
+	for _, r := range registry {
+		if r.name == name {
+			panic(fmt.Sprintf("lib: RegisterSyntax called twice for syntax %q", name))
+		}
+	}
+	registry = append(registry, &registration{name, program})
+}
+
+// SyntaxNames returns the names of the registered syntaxes in registration order.
+func SyntaxNames() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	var names []string
+	for _, r := range registry {
+		names = append(names, r.name)
+	}
+	return names
+}
+
+func LookupSyntax(name string) (Program, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for _, r := range registry {
+		if r.name == name {
+			return r.program, true
+		}
+	}
+	return nil, false
+}
+
+// Programs returns the programs of the enabled syntaxes in the given order, or of all
+// registered syntaxes if none is given, leaving out the disabled ones.
+func Programs(enabled []string, disabled []string) ([]Program, error) {
+	if len(enabled) <= 0 {
+		enabled = SyntaxNames()
+	}
+	skip := make(map[string]bool)
+	for _, n := range disabled {
+		if _, ok := LookupSyntax(n); !ok {
+			return nil, unknownSyntaxError(n)
+		}
+		skip[n] = true
+	}
+	var progs []Program
+	for _, n := range enabled {
+		p, ok := LookupSyntax(n)
+		if !ok {
+			return nil, unknownSyntaxError(n)
+		}
+		if !skip[n] {
+			progs = append(progs, p)
+		}
+	}
+	return progs, nil
+}
+
+// the name a program is registered under, programs of the same type configured otherwise share it
+func syntaxName(program Program) string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for _, r := range registry {
+		if reflect.TypeOf(r.program) == reflect.TypeOf(program) {
+			return r.name
+		}
+	}
+	return ""
+}
+
+func unknownSyntaxError(name string) error {
+	return fmt.Errorf("unknown syntax %q, available syntaxes: %s", name, strings.Join(SyntaxNames(), ", "))
+}
@@ -0,0 +1,425 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Source is a parsed file the edits of all syntaxes are made on. The nodes it hands
+// out are copies, so the file only changes once the composed edits are applied.
+type Source struct {
+	Path string
+	Fset *token.FileSet
+	File *ast.File
+
+	tokFile *token.File
+	content []byte
+	lines   *lineMap
+	// outermost first
+	nodes map[[2]int][]ast.Node
+}
+
+func ParseSource(filePath string) (*Source, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile() failed: %w", err)
+	}
+	// positions are named relative to the directory, so that //line directives
+	// printed from them hold in generated files next to the source
+	name := filepath.Base(filePath)
+	clean, lines, err := stripLineDirectives(name, content)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, name, clean, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("parser.ParseFile() failed: %w", err)
+	}
+	s := &Source{
+		Path:    filePath,
+		Fset:    fset,
+		File:    file,
+		tokFile: fset.File(file.Pos()),
+		content: content,
+		lines:   lines,
+		nodes:   make(map[[2]int][]ast.Node),
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n != nil {
+			if start, end := s.offset(n.Pos()), s.offset(n.End()); start >= 0 && end >= 0 {
+				key := [2]int{start, end}
+				s.nodes[key] = append(s.nodes[key], n)
+			}
+		}
+		return true
+	})
+	return s, nil
+}
+
+func (s *Source) ReadAt(p []byte, off int64) (int, error) {
+	return bytes.NewReader(s.content).ReadAt(p, off)
+}
+
+// offset returns the offset of pos in the file content, which extents refer to.
+func (s *Source) offset(pos token.Pos) int {
+	if !pos.IsValid() || int(pos) < s.tokFile.Base() || int(pos) > s.tokFile.Base()+s.tokFile.Size() {
+		return -1
+	}
+	return s.lines.raw(s.tokFile.Offset(pos))
+}
+
+func (s *Source) lookup(extent *Extent, match func(n ast.Node) bool) (ast.Node, error) {
+	for _, n := range s.nodes[[2]int{extent.Start.Offset, extent.End.Offset}] {
+		if match(n) {
+			return CloneNode(n), nil
+		}
+	}
+	return nil, fmt.Errorf("no matching node at %s in %s", extent, s.Path)
+}
+
+func (s *Source) Node(extent *Extent) (ast.Node, error) {
+	return s.lookup(extent, func(ast.Node) bool { return true })
+}
+
+func (s *Source) Expr(extent *Extent) (ast.Expr, error) {
+	n, err := s.lookup(extent, func(n ast.Node) bool {
+		_, ok := n.(ast.Expr)
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	return n.(ast.Expr), nil
+}
+
+func (s *Source) Exprs(extents []*Extent) ([]ast.Expr, error) {
+	var ret []ast.Expr
+	for _, e := range extents {
+		expr, err := s.Expr(e)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, expr)
+	}
+	return ret, nil
+}
+
+// ExprList returns copies of the run of list elements spanning the extent, e.g. call arguments.
+func (s *Source) ExprList(extent *Extent) ([]ast.Expr, error) {
+	start, end := extent.Start.Offset, extent.End.Offset
+	if start > end || end > len(s.content) {
+		return nil, fmt.Errorf("invalid extent %s in %s", extent, s.Path)
+	}
+	path, _ := astutil.PathEnclosingInterval(s.File, s.tokFile.Pos(s.lines.clean(start)), s.tokFile.Pos(s.lines.clean(end)))
+	for _, n := range path {
+		v := reflect.ValueOf(n).Elem()
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		for idx := 0; idx < v.NumField(); idx++ {
+			list, ok := v.Field(idx).Interface().([]ast.Expr)
+			if !ok {
+				continue
+			}
+			var run []ast.Expr
+			for _, e := range list {
+				if s.offset(e.Pos()) >= start && s.offset(e.End()) <= end {
+					run = append(run, CloneNode(e))
+				}
+			}
+			if len(run) > 0 && s.offset(run[0].Pos()) == start && s.offset(run[len(run)-1].End()) == end {
+				return run, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no matching expressions at %s in %s", extent, s.Path)
+}
+
+func (s *Source) Stmt(extent *Extent) (ast.Stmt, error) {
+	n, err := s.lookup(extent, func(n ast.Node) bool {
+		_, ok := n.(ast.Stmt)
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	return n.(ast.Stmt), nil
+}
+
+// Rewrite returns a copy of the node at extent with the blocks inside it applied.
+func (s *Source) Rewrite(extent *Extent, blocks []*ReplaceBlock) (ast.Node, error) {
+	n, err := s.Node(extent)
+	if err != nil {
+		return nil, err
+	}
+	return s.replace(n, blocks)
+}
+
+func (s *Source) apply(blocks []*ReplaceBlock) error {
+	root, err := s.replace(s.File, blocks)
+	if err != nil {
+		return err
+	}
+	s.File = root.(*ast.File)
+	return nil
+}
+
+func (s *Source) removeComment(extent *Extent) {
+	s.File.Comments = slices.DeleteFunc(s.File.Comments, func(cg *ast.CommentGroup) bool {
+		cg.List = slices.DeleteFunc(cg.List, func(c *ast.Comment) bool {
+			return s.offset(c.Pos()) == extent.Start.Offset
+		})
+		return len(cg.List) <= 0
+	})
+	if s.File.Doc != nil && len(s.File.Doc.List) <= 0 {
+		s.File.Doc = nil
+	}
+}
+
+func fits(n ast.Node, nodes []ast.Node) bool {
+	if len(nodes) <= 0 {
+		_, ok := n.(ast.Stmt)
+		return ok
+	}
+	switch nodes[0].(type) {
+	case ast.Stmt:
+		_, ok := n.(ast.Stmt)
+		return ok
+	case ast.Expr:
+		_, ok := n.(ast.Expr)
+		return ok
+	case ast.Decl:
+		_, ok := n.(ast.Decl)
+		return ok
+	case ast.Spec:
+		_, ok := n.(ast.Spec)
+		return ok
+	case *ast.Field:
+		_, ok := n.(*ast.Field)
+		return ok
+	}
+	return false
+}
+
+// each block replaces the outermost node spanning exactly its extent, or a run of list
+// elements starting and ending with it; an empty extent inserts before the element there
+func (s *Source) replace(root ast.Node, blocks []*ReplaceBlock) (ast.Node, error) {
+	byStart := make(map[int][]*ReplaceBlock)
+	for _, b := range blocks {
+		byStart[b.Old.Start.Offset] = append(byStart[b.Old.Start.Offset], b)
+	}
+	for _, bs := range byStart {
+		slices.SortStableFunc(bs, func(a, b *ReplaceBlock) int {
+			return (a.Old.End.Offset - a.Old.Start.Offset) - (b.Old.End.Offset - b.Old.Start.Offset)
+		})
+	}
+	applied := make(map[*ReplaceBlock]bool)
+	var replaceErr error
+
+	type deletion struct {
+		parent ast.Node
+		name   string
+		end    int
+	}
+	var del deletion
+
+	root = astutil.Apply(root, func(c *astutil.Cursor) bool {
+		n := c.Node()
+		if n == nil || replaceErr != nil {
+			return false
+		}
+		start, end := s.offset(n.Pos()), s.offset(n.End())
+		if start < 0 || end < 0 {
+			return true
+		}
+		if del.parent != nil && c.Parent() == del.parent && c.Name() == del.name && c.Index() >= 0 {
+			if start < del.end {
+				c.Delete()
+				return false
+			}
+			del = deletion{}
+		}
+		for _, b := range byStart[start] {
+			if applied[b] || !fits(n, b.New) {
+				continue
+			}
+			inList := c.Index() >= 0
+			switch {
+			case b.Old.Start.Offset == b.Old.End.Offset:
+				if !inList {
+					continue
+				}
+				for _, nn := range b.New {
+					fillPositions(reflect.ValueOf(nn), n.Pos(), n.Pos(), n.End())
+					c.InsertBefore(nn)
+				}
+				applied[b] = true
+			case end == b.Old.End.Offset || (end < b.Old.End.Offset && inList):
+				if len(b.New) > 1 && !inList {
+					replaceErr = fmt.Errorf("cannot replace %T at %s with %d nodes", n, b.Old.Start, len(b.New))
+					return false
+				}
+				for _, nn := range b.New {
+					fillPositions(reflect.ValueOf(nn), n.Pos(), n.Pos(), s.tokFile.Pos(s.lines.clean(max(end, b.Old.End.Offset))))
+				}
+				switch {
+				case len(b.New) > 0:
+					c.Replace(b.New[0])
+					for idx := len(b.New) - 1; idx > 0; idx-- {
+						c.InsertAfter(b.New[idx])
+					}
+				case inList:
+					c.Delete()
+				default:
+					c.Replace(&ast.EmptyStmt{Semicolon: n.Pos(), Implicit: true})
+				}
+				if end < b.Old.End.Offset {
+					del = deletion{c.Parent(), c.Name(), b.Old.End.Offset}
+				}
+				applied[b] = true
+				return false
+			}
+		}
+		return true
+	}, nil)
+	if replaceErr != nil {
+		return nil, replaceErr
+	}
+	for _, b := range blocks {
+		if !applied[b] {
+			return nil, fmt.Errorf("no node at %s in %s matches the edit", &b.Old, s.Path)
+		}
+	}
+	return root, nil
+}
+
+// CloneNode deeply copies a syntax tree, keeping positions and sharing comments.
+func CloneNode[N ast.Node](n N) N {
+	return cloneValue(reflect.ValueOf(n)).Interface().(N)
+}
+
+// ParseExpr parses an expression without positions, e.g. a type printed by go/types.
+func ParseExpr(x string) (ast.Expr, error) {
+	expr, err := parser.ParseExpr(x)
+	if err != nil {
+		return nil, fmt.Errorf("parser.ParseExpr() failed: %w", err)
+	}
+	clearPositions(reflect.ValueOf(expr))
+	return expr, nil
+}
+
+var (
+	posType          = reflect.TypeOf(token.NoPos)
+	objectType       = reflect.TypeOf((*ast.Object)(nil))
+	scopeType        = reflect.TypeOf((*ast.Scope)(nil))
+	commentGroupType = reflect.TypeOf((*ast.CommentGroup)(nil))
+	// positions whose validity changes the printed syntax
+	semanticPos = map[string]bool{
+		"ast.CallExpr.Ellipsis": true,
+		"ast.GenDecl.Lparen":    true,
+		"ast.GenDecl.Rparen":    true,
+	}
+)
+
+func cloneValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || v.Type() == objectType || v.Type() == scopeType || v.Type() == commentGroupType {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(cloneValue(v.Elem()))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		for idx := 0; idx < v.NumField(); idx++ {
+			c.Field(idx).Set(cloneValue(v.Field(idx)))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for idx := 0; idx < v.Len(); idx++ {
+			c.Index(idx).Set(cloneValue(v.Index(idx)))
+		}
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(cloneValue(v.Elem()))
+		return c
+	}
+	return v
+}
+
+// generated nodes take the position of the syntax they replace, so that they are printed
+// on its line and comments around it are printed before or after them instead of in
+// between. Only statements from inside the syntax keep theirs, for //line directives.
+func fillPositions(v reflect.Value, pos, lo, hi token.Pos) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || v.Type() == objectType || v.Type() == scopeType || v.Type() == commentGroupType {
+			return
+		}
+		if stmt, ok := v.Interface().(ast.Stmt); ok && stmt.Pos().IsValid() && lo <= stmt.Pos() && stmt.End() <= hi {
+			return
+		}
+		fillPositions(v.Elem(), pos, lo, hi)
+	case reflect.Struct:
+		for idx := 0; idx < v.NumField(); idx++ {
+			f := v.Field(idx)
+			if f.Type() != posType {
+				fillPositions(f, pos, lo, hi)
+			} else if token.Pos(f.Int()).IsValid() || !semanticPos[v.Type().String()+"."+v.Type().Field(idx).Name] {
+				f.SetInt(int64(pos))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for idx := 0; idx < v.Len(); idx++ {
+			fillPositions(v.Index(idx), pos, lo, hi)
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			fillPositions(v.Elem(), pos, lo, hi)
+		}
+	}
+}
+
+func clearPositions(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() && v.Type() != objectType && v.Type() != scopeType {
+			clearPositions(v.Elem())
+		}
+	case reflect.Struct:
+		for idx := 0; idx < v.NumField(); idx++ {
+			if f := v.Field(idx); f.Type() == posType {
+				f.SetInt(int64(token.NoPos))
+			} else {
+				clearPositions(f)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for idx := 0; idx < v.Len(); idx++ {
+			clearPositions(v.Index(idx))
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			clearPositions(v.Elem())
+		}
+	}
+}
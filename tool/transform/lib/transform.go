@@ -0,0 +1,61 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Transform runs the programs over the packages of cfg in place and returns the
+// diagnostics of the sugar calls that could not be lowered.
+func Transform(ctx context.Context, cfg *Config, programs []Program) (Diagnostics, error) {
+	manifest, err := LoadManifest(cfg.RootDir)
+	if err != nil {
+		return nil, fmt.Errorf("load manifest failed: %w", err)
+	}
+	cfg = cfg.WithManifest(manifest)
+
+	if err := SetTmpBuildTags(ctx, cfg); err != nil {
+		return nil, fmt.Errorf("change build tags failed: %w", err)
+	}
+	// the original directives are kept on disk for clean in case the run is interrupted
+	if err := manifest.Save(); err != nil {
+		return nil, fmt.Errorf("save manifest failed: %w", err)
+	}
+
+	var translations []Translation
+	for _, p := range programs {
+		translations = append(translations, &namedTranslation{p.Translation(), syntaxName(p)})
+	}
+	var diagnostics Diagnostics
+	runErr := Translate(ctx, cfg, translations...)
+	if errors.As(runErr, &diagnostics) {
+		runErr = nil
+	}
+
+	if err := SetProdBuildTags(ctx, cfg); err != nil {
+		return nil, fmt.Errorf("change build tags failed: %w", err)
+	}
+	if err := manifest.Save(); err != nil {
+		return nil, fmt.Errorf("save manifest failed: %w", err)
+	}
+	if runErr != nil {
+		return nil, runErr
+	}
+	return diagnostics, nil
+}
+
+// Inspect runs the inspectors of the programs over a type-checked package without generating
+// code, and returns the diagnostics of the sugar calls that could not be lowered. The imports of
+// pkg may only carry their types, as they do in a go/analysis pass.
+func Inspect(pkg *packages.Package, programs []Program) Diagnostics {
+	var diagnostics Diagnostics
+	for _, p := range programs {
+		_, diags := p.Translation().inspect([]*packages.Package{pkg})
+		diagnostics = append(diagnostics, diags...)
+	}
+	diagnostics.Sort()
+	return diagnostics
+}
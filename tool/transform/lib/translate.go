@@ -4,149 +4,315 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
-	"strings"
+	"slices"
 
+	"golang.org/x/sync/errgroup"
 	"golang.org/x/tools/go/packages"
 )
 
+// Program is a syntax registered with RegisterSyntax. Run transforms the packages
+// selected by cfg, and Translation lets the syntax share package loads with others.
 type Program interface {
-	Run(ctx context.Context, rootDir string, firstRun bool) error
+	Run(ctx context.Context, cfg *Config, firstRun bool) error
+	Translation() Translation
 }
 
+// SyntaxTranslator finds the sugar types of a package, the syntax using them, and
+// edits each file which uses the syntax. Wrap it with NewTranslation.
 type SyntaxTranslator[Type, Syntax interface {
 	fmt.Stringer
 	comparable
 }] interface {
 	InpectTypes(p *packages.Package) []Type
 	InspectSyntax(p *packages.Package, instTypes []Type) SyntaxInspector[Syntax]
-	Generate(info *FileInfo[Syntax], writer io.Writer) error
+	Edit(info *FileInfo[Syntax], src *Source, addImports map[string]string) ([]*ReplaceBlock, error)
+}
+
+type Translation interface {
+	inspect(pkgs []*packages.Package) ([]*fileJob, Diagnostics)
+}
+
+type fileJob struct {
+	path     string
+	buildTag *Extent
+	imports  map[string]string
+	edits    []*syntaxEdit
+}
+
+type syntaxEdit struct {
+	syntax string
+	edit   FileEdit
+}
+
+// namedTranslation records the name of the syntax with the edits of a translation.
+type namedTranslation struct {
+	Translation
+	name string
+}
+
+func (t *namedTranslation) inspect(pkgs []*packages.Package) ([]*fileJob, Diagnostics) {
+	jobs, diagnostics := t.Translation.inspect(pkgs)
+	for _, job := range jobs {
+		for _, e := range job.edits {
+			e.syntax = t.name
+		}
+	}
+	return jobs, diagnostics
+}
+
+type syntaxTranslation[Type, Syntax interface {
+	fmt.Stringer
+	comparable
+}] struct {
+	translator SyntaxTranslator[Type, Syntax]
+}
+
+func NewTranslation[Type, Syntax interface {
+	fmt.Stringer
+	comparable
+}](translator SyntaxTranslator[Type, Syntax]) Translation {
+	return &syntaxTranslation[Type, Syntax]{translator}
+}
+
+func (t *syntaxTranslation[Type, Syntax]) inspect(pkgs []*packages.Package) ([]*fileJob, Diagnostics) {
+	var instTypes []Type
+	for _, p := range pkgs {
+		instTypes = append(instTypes, t.translator.InpectTypes(p)...)
+		for path, dep := range p.Imports {
+			if p.PkgPath != path {
+				instTypes = append(instTypes, t.translator.InpectTypes(dep)...)
+			}
+		}
+	}
+
+	var jobs []*fileJob
+	var diagnostics Diagnostics
+	for _, p := range pkgs {
+		pkgInspector := NewPackageInspector(p, t.translator.InspectSyntax(p, instTypes))
+		for _, info := range pkgInspector.Inspect() {
+			info := info
+			jobs = append(jobs, &fileJob{
+				path:     info.Path,
+				buildTag: info.BuildTag,
+				imports:  info.Imports,
+				edits: []*syntaxEdit{{edit: func(src *Source, addImports map[string]string) ([]*ReplaceBlock, error) {
+					return t.translator.Edit(info, src, addImports)
+				}}},
+			})
+		}
+		diagnostics = append(diagnostics, pkgInspector.Diagnostics()...)
+	}
+	return jobs, diagnostics
 }
 
 func TranslateSyntax[Type, Syntax interface {
 	fmt.Stringer
 	comparable
 }](
-	ctx context.Context, rootDir string, firstRun bool,
+	ctx context.Context, cfg *Config, firstRun bool,
 	translator SyntaxTranslator[Type, Syntax],
 ) error {
+	return translate(ctx, cfg, firstRun, []Translation{NewTranslation(translator)})
+}
+
+func Translate(ctx context.Context, cfg *Config, translations ...Translation) error {
+	return translate(ctx, cfg, true, translations)
+}
 
+func translate(ctx context.Context, cfg *Config, firstRun bool, translations []Translation) error {
 	var finished bool
+	var tagged bool
 	var buildTags []string
+	var diagnostics DiagnosticSet
+	// packages with diagnostics are neither tagged nor generated, so the tree never holds code which does not build
+	blocked := make(map[string]bool)
 
 	for !finished {
 		finished = true
 
-		pkgs, err := LoadPackages(ctx, rootDir, buildTags...)
+		// packages are loaded once per iteration and shared by all translations
+		pkgs, err := LoadPackages(ctx, cfg, buildTags...)
 		if err != nil {
 			return fmt.Errorf("load source packages failed: %w", err)
 		}
-		var instTypes []Type
-		for _, p := range pkgs {
-			instTypes = append(instTypes, translator.InpectTypes(p)...)
-			for path, dep := range p.Imports {
-				if p.PkgPath != path {
-					instTypes = append(instTypes, translator.InpectTypes(dep)...)
+		// edits of all translations to the same file are composed into a single rewrite
+		var fileJobs []*fileJob
+		jobsByPath := make(map[string]*fileJob)
+		var translationDiags Diagnostics
+		for _, t := range translations {
+			jobs, diags := t.inspect(pkgs)
+			for _, job := range jobs {
+				if fileJob, ok := jobsByPath[job.path]; ok {
+					fileJob.edits = append(fileJob.edits, job.edits...)
+					continue
 				}
+				jobsByPath[job.path] = job
+				fileJobs = append(fileJobs, job)
 			}
+			translationDiags = append(translationDiags, diags...)
 		}
+		if len(buildTags) <= 0 {
+			for _, d := range translationDiags {
+				blocked[filepath.Dir(d.Pos.Filename)] = true
+			}
+		}
+		fileJobs = slices.DeleteFunc(fileJobs, func(job *fileJob) bool {
+			return blocked[filepath.Dir(job.path)]
+		})
 
-		var totalFiles []*FileInfo[Syntax]
-		for _, p := range pkgs {
-			files := NewPackageInspector(p, translator.InspectSyntax(p, instTypes)).Inspect()
-			for _, info := range files {
-				func() {
-					ext := filepath.Ext(info.Path)
-					newFile := strings.TrimSuffix(info.Path, ext) + "_" + prodBuildTag + ext
-					if _, err := os.Stat(newFile); err == nil {
-						if !firstRun {
-							return
-						}
-					}
-					file, err := os.OpenFile(newFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
-					if err != nil {
-						fmt.Println("open file", newFile, "failed:", err)
-						return
-					}
-					defer file.Close()
-
-					err = translator.Generate(info, file)
-					if err != nil {
-						fmt.Println("generate code of", info.Path, "failed:", err)
-						return
+		// generated names derive from source positions, which must not shift once the directive is added
+		if len(buildTags) <= 0 && !tagged {
+			tagged = true
+			var untagged int
+			for _, job := range fileJobs {
+				if job.buildTag == nil {
+					if err := prependTmpBuildTags(job.path); err != nil {
+						return fmt.Errorf("prependTmpBuildTags() failed: %w", err)
 					}
+					cfg.Manifest.AddTagged(job.path)
+					untagged++
+				}
+			}
+			if untagged > 0 {
+				finished = false
+				continue
+			}
+		}
 
-					if err = FormatCode(ctx, newFile, tmpBuildTag); err != nil {
-						fmt.Println("format code of", newFile, "failed:", err)
-					}
+		if len(buildTags) <= 0 {
+			diagnostics.Add(translationDiags...)
+		}
 
-					if len(buildTags) > 0 {
-						if err := os.Remove(info.Path); err != nil {
-							fmt.Println("remove file", info.Path, "failed:", err)
-							return
-						}
-						if err := os.Rename(newFile, info.Path); err != nil {
-							fmt.Println("rename file", newFile, "failed:", err)
-							return
-						}
-					} else {
-						buf := bytes.NewBuffer(nil)
-						if info.BuildTag == nil {
-							buf.Write([]byte(GenTmpBuildTags(false)))
-						}
-						bs, err := os.ReadFile(info.Path)
-						if err != nil {
-							fmt.Println("read file", info.Path, "failed:", err)
-							return
-						}
-						buf.Write(bs)
-						tmpOldFileNam := info.Path + ".old"
-						if err := os.WriteFile(tmpOldFileNam, buf.Bytes(), 0644); err != nil {
-							fmt.Println("write file", tmpOldFileNam, "failed:", err)
-							return
-						}
-						if err := os.Remove(info.Path); err != nil {
-							fmt.Println("remove file", info.Path, "failed:", err)
-							return
-						}
-						if err := os.Rename(tmpOldFileNam, info.Path); err != nil {
-							fmt.Println("rename file", tmpOldFileNam, "failed:", err)
-							return
-						}
-					}
-				}()
-			}
-			totalFiles = append(totalFiles, files...)
+		group, groupCtx := errgroup.WithContext(ctx)
+		group.SetLimit(cfg.jobs())
+		for _, job := range fileJobs {
+			job := job
+			group.Go(func() error {
+				return generateFile(groupCtx, cfg, firstRun, len(buildTags) > 0, job)
+			})
+		}
+		if err := group.Wait(); err != nil {
+			return err
 		}
-		if len(buildTags) <= 0 || len(totalFiles) > 0 {
+		if len(buildTags) <= 0 || len(fileJobs) > 0 {
 			finished = false
 		}
-		buildTags = []string{"-tags=" + tmpBuildTag}
+		buildTags = []string{tmpBuildTag}
+	}
+	if diags := diagnostics.Diagnostics(); len(diags) > 0 {
+		return diags
+	}
+	return nil
+}
+
+func generateFile(ctx context.Context, cfg *Config, firstRun bool, generated bool, job *fileJob) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	newFile := ProductionFileName(job.path)
+	if _, err := os.Stat(newFile); err == nil {
+		if !firstRun {
+			return nil
+		}
+	}
+	file, err := os.OpenFile(newFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile() failed: %w", err)
+	}
+	defer file.Close()
+	cfg.Logf("generate %s from %s", newFile, job.path)
+	if !generated {
+		cfg.Manifest.AddGenerated(newFile)
+	}
+
+	edits, err := writeEdits(job.path, job.buildTag, job.imports, file, job.edits)
+	if err != nil {
+		return fmt.Errorf("generate code of %s failed: %w", job.path, err)
+	}
+	// the edits of earlier passes over a generated file are kept with the source ranges they replaced
+	if generated {
+		if m, err := LoadPositionMap(job.path); err == nil {
+			edits = append(m.Edits, edits...)
+		}
+	}
+
+	if err = FormatCode(ctx, newFile); err != nil {
+		return err
+	}
+
+	if generated {
+		if err := os.Remove(job.path); err != nil {
+			return fmt.Errorf("os.Remove() failed: %w", err)
+		}
+		if err := os.Rename(newFile, job.path); err != nil {
+			return fmt.Errorf("os.Rename() failed: %w", err)
+		}
+	} else {
+		buf := bytes.NewBuffer(nil)
+		if job.buildTag == nil {
+			buf.Write([]byte(GenTmpBuildTags(false)))
+			cfg.Manifest.AddTagged(job.path)
+		}
+		bs, err := os.ReadFile(job.path)
+		if err != nil {
+			return fmt.Errorf("os.ReadFile() failed: %w", err)
+		}
+		buf.Write(bs)
+		tmpOldFileNam := job.path + ".old"
+		if err := os.WriteFile(tmpOldFileNam, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("os.WriteFile() failed: %w", err)
+		}
+		if err := os.Remove(job.path); err != nil {
+			return fmt.Errorf("os.Remove() failed: %w", err)
+		}
+		if err := os.Rename(tmpOldFileNam, job.path); err != nil {
+			return fmt.Errorf("os.Rename() failed: %w", err)
+		}
+	}
+
+	// only now are the lines of both the generated file and its source final
+	if generated {
+		newFile = job.path
+	}
+	if err := WritePositionMap(newFile, edits); err != nil {
+		return fmt.Errorf("write position map of %s failed: %w", newFile, err)
+	}
+	return nil
+}
+
+func prependTmpBuildTags(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("os.ReadFile() failed: %w", err)
+	}
+	content = append([]byte(GenTmpBuildTags(false)), content...)
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("os.WriteFile() failed: %w", err)
 	}
 	return nil
 }
 
-func changeBuildTags(ctx context.Context, rootDir string, old string, new string) error {
+func changeBuildTags(ctx context.Context, cfg *Config, old string, new string) error {
 	var finished bool
 	var buildTags []string
 
 	for !finished {
 		finished = true
 
-		pkgs, err := LoadPackages(ctx, rootDir, buildTags...)
+		pkgs, err := LoadPackages(ctx, cfg, buildTags...)
 		if err != nil {
 			return fmt.Errorf("load source packages failed: %w", err)
 		}
 		for _, p := range pkgs {
-			if err := replaceBuildTags(FindPackageBuildTags(p), old, new); err != nil {
+			if err := replaceBuildTags(cfg.Manifest, FindPackageBuildTags(p), old, new); err != nil {
 				return fmt.Errorf("MakePackageTemp() failed: %w", err)
 			}
 		}
 
 		if len(buildTags) <= 0 {
-			buildTags = []string{"-tags=" + old}
+			buildTags = []string{old}
 			finished = false
 		}
 	}
@@ -154,10 +320,10 @@ func changeBuildTags(ctx context.Context, rootDir string, old string, new string
 	return nil
 }
 
-func SetTmpBuildTags(ctx context.Context, rootDir string) error {
-	return changeBuildTags(ctx, rootDir, prodBuildTag, tmpBuildTag)
+func SetTmpBuildTags(ctx context.Context, cfg *Config) error {
+	return changeBuildTags(ctx, cfg, prodBuildTag, tmpBuildTag)
 }
 
-func SetProdBuildTags(ctx context.Context, rootDir string) error {
-	return changeBuildTags(ctx, rootDir, tmpBuildTag, prodBuildTag)
+func SetProdBuildTags(ctx context.Context, cfg *Config) error {
+	return changeBuildTags(ctx, cfg, tmpBuildTag, prodBuildTag)
 }
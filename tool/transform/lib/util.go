@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/base32"
 	"fmt"
+	"go/ast"
 	"go/types"
 	"path"
 	"regexp"
@@ -12,6 +13,7 @@ import (
 
 var mainTypeRe = regexp.MustCompile(`^\**([a-zA-Z0-9_\-./]+)`)
 var anyTypeRe = regexp.MustCompile(`[a-zA-Z0-9_\-./]+`)
+var hintPathRe = regexp.MustCompile(`[^\s:;,\[\]]*[/\\]([^/\\\s:;,\[\]]+\.go)`)
 
 func GetPkgPathFromTypeStr(str string) string {
 	matches := mainTypeRe.FindStringSubmatch(str)
@@ -87,6 +89,8 @@ func GenPkgName(prefix string, nameHint string) string {
 }
 
 func GenVarName(prefix string, nameHint string) string {
+	// names must not depend on where the source tree is located
+	nameHint = hintPathRe.ReplaceAllString(nameHint, "$1")
 	sum := sha256.Sum256([]byte(nameHint))
 	return prefix + strings.TrimRight(base32.HexEncoding.EncodeToString(sum[13:19]), "=")
 }
@@ -101,3 +105,57 @@ func JoinStringers[S []T, T fmt.Stringer](ss S, sep string) string {
 	}
 	return ret
 }
+
+type ZeroValue struct {
+	Type      string
+	Literal   string
+	Composite bool
+}
+
+func NewZeroValue(ty types.Type) *ZeroValue {
+	zero := &ZeroValue{Type: ty.String()}
+	if _, ok := ty.(*types.TypeParam); ok {
+		return zero
+	}
+	switch t := ty.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case t.Info()&types.IsBoolean != 0:
+			zero.Literal = "false"
+		case t.Info()&types.IsString != 0:
+			zero.Literal = `""`
+		case t.Info()&types.IsNumeric != 0:
+			zero.Literal = "0"
+		case t.Kind() == types.UnsafePointer:
+			zero.Literal = "nil"
+		}
+	case *types.Pointer, *types.Slice, *types.Map, *types.Chan, *types.Signature, *types.Interface:
+		zero.Literal = "nil"
+	case *types.Struct, *types.Array:
+		zero.Composite = true
+	}
+	return zero
+}
+
+func (z *ZeroValue) String() string {
+	if z == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("Type: %s, Literal: %s, Composite: %t", z.Type, z.Literal, z.Composite)
+}
+
+func (z *ZeroValue) Gen(imports map[string]string, currentPkg string) (ret ast.Expr, adds map[string]string, err error) {
+	if len(z.Literal) > 0 {
+		ret, err = ParseExpr(z.Literal)
+		return
+	}
+	typ, adds := ResetTypeStrPkgName(z.Type, imports, currentPkg)
+	typExpr, err := ParseExpr(typ)
+	if err != nil {
+		return nil, nil, err
+	}
+	if z.Composite {
+		return &ast.CompositeLit{Type: typExpr}, adds, nil
+	}
+	return &ast.StarExpr{X: &ast.CallExpr{Fun: ast.NewIdent("new"), Args: []ast.Expr{typExpr}}}, adds, nil
+}
@@ -4,8 +4,8 @@ import (
 	"context"
 	"fmt"
 	"go/ast"
+	"go/token"
 	"io"
-	"os"
 	"strconv"
 	"strings"
 
@@ -13,6 +13,8 @@ import (
 	"golang.org/x/tools/go/packages"
 )
 
+const SyntaxName = "predefine"
+
 const (
 	predefPkgPath = "github.com/arcane-craft/sugar/syntax/predef"
 
@@ -170,30 +172,38 @@ func (*Translator) InspectSyntax(p *packages.Package, _ []*lib.Extent) lib.Synta
 	return NewSyntaxInspector(p)
 }
 
-func genStringLit(s string) string {
-	return fmt.Sprintf("\"%s\"", s)
+func genStringLit(s string) ast.Expr {
+	return &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(s)}
 }
 
-func (*Translator) Generate(info *lib.FileInfo[*PredefSyntax], writer io.Writer) error {
-	return lib.GenerateSyntax(info, writer, func(file *os.File, addImports map[string]string) ([]*lib.ReplaceBlock, error) {
-		var blocks []*lib.ReplaceBlock
-		for _, syntax := range info.Syntax {
-			blocks = append(blocks, &lib.ReplaceBlock{
-				Old: *syntax.Ident.Extent,
-				New: genStringLit(syntax.Ident.Value),
-			})
-		}
-		for path := range addImports {
-			if path == predefPkgPath {
-				delete(addImports, path)
-			}
-		}
-		return blocks, nil
+func (t *Translator) Generate(info *lib.FileInfo[*PredefSyntax], writer io.Writer) error {
+	return lib.GenerateSyntax(info, writer, func(src *lib.Source, addImports map[string]string) ([]*lib.ReplaceBlock, error) {
+		return t.Edit(info, src, addImports)
 	})
 }
 
-func (t *Translator) Run(ctx context.Context, rootDir string, firstRun bool) error {
-	err := lib.TranslateSyntax(ctx, rootDir, firstRun, t)
+func (*Translator) Edit(info *lib.FileInfo[*PredefSyntax], _ *lib.Source, addImports map[string]string) ([]*lib.ReplaceBlock, error) {
+	var blocks []*lib.ReplaceBlock
+	for _, syntax := range info.Syntax {
+		blocks = append(blocks, &lib.ReplaceBlock{
+			Old: *syntax.Ident.Extent,
+			New: []ast.Node{genStringLit(syntax.Ident.Value)},
+		})
+	}
+	for path := range addImports {
+		if path == predefPkgPath {
+			delete(addImports, path)
+		}
+	}
+	return blocks, nil
+}
+
+func (t *Translator) Translation() lib.Translation {
+	return lib.NewTranslation[*lib.Extent, *PredefSyntax](t)
+}
+
+func (t *Translator) Run(ctx context.Context, cfg *lib.Config, firstRun bool) error {
+	err := lib.TranslateSyntax(ctx, cfg, firstRun, t)
 	if err != nil {
 		return fmt.Errorf("translate predefine syntax failed: %w", err)
 	}
@@ -5,25 +5,50 @@ import (
 	"fmt"
 	"go/ast"
 	"go/token"
+	"go/types"
 	"io"
-	"os"
 	"path"
 	"strings"
 
+	"github.com/arcane-craft/sugar/tool/transform/exception"
 	"github.com/arcane-craft/sugar/tool/transform/lib"
+	"golang.org/x/mod/module"
 	"golang.org/x/tools/go/ast/inspector"
 	"golang.org/x/tools/go/packages"
 )
 
+const SyntaxName = "question_mark"
+
 const (
 	questionPkgPath = "github.com/arcane-craft/sugar/syntax/question"
 	questionIface   = "Question"
 	questionFun     = "Q"
 	resultPkgPath   = "github.com/arcane-craft/sugar/result"
 	optionPkgPath   = "github.com/arcane-craft/sugar/option"
+	tuplePkgPath    = "github.com/arcane-craft/sugar/tuple"
+	sugarPkgPath    = "github.com/arcane-craft/sugar"
 	stdFmtPkgPath   = "fmt"
+	errorTypeName   = "error"
+	resultTypeName  = resultPkgPath + ".Result"
+	defaultNoneErr  = optionPkgPath + ".ErrNone"
 )
 
+const (
+	WrapperFrom      = "From"
+	WrapperFrom2     = "From2"
+	WrapperFrom3     = "From3"
+	WrapperFromUnit  = "From_"
+	WrapperFromComma = "FromComma"
+)
+
+var wrapperPkgPaths = map[string]string{
+	WrapperFrom:      resultPkgPath,
+	WrapperFrom2:     resultPkgPath,
+	WrapperFrom3:     resultPkgPath,
+	WrapperFromUnit:  resultPkgPath,
+	WrapperFromComma: optionPkgPath,
+}
+
 type QuestionTypeInspector struct {
 	pkg *packages.Package
 }
@@ -108,9 +133,37 @@ func (i *QuestionTypeInspector) Inspect() []*QuestionInstanceType {
 	return ret
 }
 
+func InspectPackageTypes(pkg *types.Package) []*QuestionInstanceType {
+	var ret []*QuestionInstanceType
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		typeName, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		ifaceType, ok := typeName.Type().Underlying().(*types.Interface)
+		if !ok {
+			continue
+		}
+		for idx := 0; idx < ifaceType.NumEmbeddeds(); idx++ {
+			named, ok := ifaceType.EmbeddedType(idx).(*types.Named)
+			if ok && named.Obj().Name() == questionIface &&
+				named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == questionPkgPath {
+				ret = append(ret, &QuestionInstanceType{
+					Name: pkg.Path() + "." + typeName.Name(),
+				})
+				break
+			}
+		}
+	}
+	return ret
+}
+
 type QuestionSyntaxInspector struct {
-	pkg           *packages.Package
-	instanceTypes map[string]*QuestionInstanceType
+	pkg             *packages.Package
+	instanceTypes   map[string]*QuestionInstanceType
+	exceptionBlocks map[*ast.FuncLit]bool
+	diagnostics     lib.DiagnosticSet
 }
 
 func NewQuestionSyntaxInspector(pkg *packages.Package, instances []*QuestionInstanceType) *QuestionSyntaxInspector {
@@ -119,8 +172,9 @@ func NewQuestionSyntaxInspector(pkg *packages.Package, instances []*QuestionInst
 		instanceTypes[inst.Name] = inst
 	}
 	return &QuestionSyntaxInspector{
-		pkg:           pkg,
-		instanceTypes: instanceTypes,
+		pkg:             pkg,
+		instanceTypes:   instanceTypes,
+		exceptionBlocks: exception.BlockLiterals(pkg),
 	}
 }
 
@@ -131,11 +185,22 @@ type QuestionCall struct {
 	AssignToken string
 	ExprType    string
 	OuterStmt   *lib.Extent
+	Wrapper     string
+	WrappedArgs *lib.Extent
 }
 
 type QImplType struct {
 	MainType  string
 	InnerType string
+	Results   []*lib.ZeroValue
+}
+
+func (t *QImplType) IsErrorTuple() bool {
+	return t.MainType == errorTypeName
+}
+
+func isResultType(name string) bool {
+	return name == resultTypeName
 }
 
 type QuestionSyntax struct {
@@ -181,6 +246,41 @@ func (i *QuestionSyntaxInspector) findQuestionFnCall(expr ast.Expr) (*lib.Extent
 	return nil, ""
 }
 
+func (i *QuestionSyntaxInspector) findWrapperCall(expr ast.Expr) (string, *lib.Extent) {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok || len(call.Args) <= 0 {
+		return "", nil
+	}
+	fun := call.Fun
+	switch f := fun.(type) {
+	case *ast.IndexExpr:
+		fun = f.X
+	case *ast.IndexListExpr:
+		fun = f.X
+	}
+	var ident *ast.Ident
+	switch f := fun.(type) {
+	case *ast.Ident:
+		ident = f
+	case *ast.SelectorExpr:
+		ident = f.Sel
+	}
+	if ident == nil {
+		return "", nil
+	}
+	pkgPath, ok := wrapperPkgPaths[ident.Name]
+	if !ok {
+		return "", nil
+	}
+	if obj := i.pkg.TypesInfo.ObjectOf(ident); obj == nil || obj.Pkg() == nil || obj.Pkg().Path() != pkgPath {
+		return "", nil
+	}
+	return ident.Name, &lib.Extent{
+		Start: i.pkg.Fset.Position(call.Args[0].Pos()),
+		End:   i.pkg.Fset.Position(call.Args[len(call.Args)-1].End()),
+	}
+}
+
 func (i *QuestionSyntaxInspector) queryFuncRetType(t ast.Expr) *QImplType {
 	expr, ok := t.(*ast.IndexExpr)
 	if ok {
@@ -192,8 +292,34 @@ func (i *QuestionSyntaxInspector) queryFuncRetType(t ast.Expr) *QImplType {
 	return nil
 }
 
+func (i *QuestionSyntaxInspector) queryFuncErrorTuple(typ *ast.FuncType) *QImplType {
+	var results []types.Type
+	for _, field := range typ.Results.List {
+		fieldType := i.pkg.TypesInfo.TypeOf(field.Type)
+		if fieldType == nil {
+			return nil
+		}
+		for idx := 0; idx < max(len(field.Names), 1); idx++ {
+			results = append(results, fieldType)
+		}
+	}
+	if !types.Identical(results[len(results)-1], types.Universe.Lookup(errorTypeName).Type()) {
+		return nil
+	}
+	retType := &QImplType{
+		MainType: errorTypeName,
+	}
+	for _, r := range results[:len(results)-1] {
+		retType.Results = append(retType.Results, lib.NewZeroValue(r))
+	}
+	return retType
+}
+
 func (i *QuestionSyntaxInspector) queryFuncType(typ *ast.FuncType) *QImplType {
-	if typ.Results != nil && typ.Results.NumFields() == 1 {
+	if typ.Results == nil || typ.Results.NumFields() <= 0 {
+		return nil
+	}
+	if typ.Results.NumFields() == 1 {
 		retType := i.queryFuncRetType(typ.Results.List[0].Type)
 		if retType != nil {
 			if _, ok := i.instanceTypes[retType.MainType]; ok {
@@ -201,7 +327,20 @@ func (i *QuestionSyntaxInspector) queryFuncType(typ *ast.FuncType) *QImplType {
 			}
 		}
 	}
-	return nil
+	return i.queryFuncErrorTuple(typ)
+}
+
+func (i *QuestionSyntaxInspector) isPropagable(exprType string, retType *QImplType) bool {
+	exprMainType := lib.GetNameFromTypeStr(exprType)
+	switch {
+	case retType.MainType == exprMainType:
+		return true
+	case retType.IsErrorTuple():
+		return true
+	case retType.MainType == resultTypeName:
+		return !isResultType(exprMainType)
+	}
+	return false
 }
 
 func (i *QuestionSyntaxInspector) Inspect(n ast.Node, stack []ast.Node) (syntax *QuestionSyntax) {
@@ -211,13 +350,22 @@ func (i *QuestionSyntaxInspector) Inspect(n ast.Node, stack []ast.Node) (syntax
 		Expr:     exprExt,
 		ExprType: exprType,
 	}
+	if exprExt != nil {
+		call.Wrapper, call.WrappedArgs = i.findWrapperCall(callExpr.Fun.(*ast.SelectorExpr).X)
+	}
+	var retType *QImplType
+	var outerFn string
+	var inBlock bool
 	if exprExt != nil && len(stack) > 1 {
-		var retType *QImplType
-		var outerFn string
 	FindOuterFunc:
 		for idx := len(stack) - 2; idx >= 0; idx-- {
 			switch fn := stack[idx].(type) {
 			case *ast.FuncLit:
+				// the blocks of the exception syntax are inlined into the function around them
+				if i.exceptionBlocks[fn] {
+					inBlock = true
+					continue
+				}
 				retType = i.queryFuncType(fn.Type)
 				outerFn = i.pkg.TypesInfo.TypeOf(fn).String()
 				break FindOuterFunc
@@ -227,7 +375,11 @@ func (i *QuestionSyntaxInspector) Inspect(n ast.Node, stack []ast.Node) (syntax
 				break FindOuterFunc
 			}
 		}
-		if retType != nil && retType.MainType == lib.GetNameFromTypeStr(exprType) {
+		if retType != nil && i.isPropagable(exprType, retType) {
+			// lowered once the block is inlined
+			if inBlock {
+				return nil
+			}
 			if len(stack) > 2 {
 				for idx := len(stack) - 2; idx >= 0; idx-- {
 					stmt, ok := stack[idx].(ast.Stmt)
@@ -319,158 +471,322 @@ func (i *QuestionSyntaxInspector) Inspect(n ast.Node, stack []ast.Node) (syntax
 			}
 		}
 	}
+	if exprExt != nil && syntax == nil {
+		i.reportUnpropagable(callExpr, exprType, outerFn)
+	}
 	return
 }
 
-func GenAssginStmt(assignVar, assignToken, call string) string {
-	return fmt.Sprintf("%s %s %s\n", assignVar, assignToken, call)
+func (i *QuestionSyntaxInspector) reportUnpropagable(callExpr *ast.CallExpr, exprType string, outerFn string) {
+	var reason string
+	if len(outerFn) <= 0 {
+		reason = fmt.Sprintf("%s() on %s must be called inside a function", questionFun, exprType)
+	} else {
+		exprMainType := lib.GetNameFromTypeStr(exprType)
+		expected := exprMainType
+		if !isResultType(exprMainType) {
+			expected += " or " + resultTypeName
+		}
+		reason = fmt.Sprintf("%s() on %s cannot propagate out of %s: the function must return %s or have error as its last result",
+			questionFun, exprType, outerFn, expected)
+	}
+	i.diagnostics.Add(&lib.Diagnostic{
+		Pos:    i.pkg.Fset.Position(callExpr.Fun.(*ast.SelectorExpr).Sel.Pos()),
+		Syntax: SyntaxName,
+		Reason: reason,
+	})
+}
+
+func (i *QuestionSyntaxInspector) Diagnostics() lib.Diagnostics {
+	return i.diagnostics.Diagnostics()
+}
+
+func GenAssginStmt(lhs []ast.Expr, assignToken token.Token, rhs []ast.Expr) ast.Stmt {
+	return &ast.AssignStmt{Lhs: lhs, Tok: assignToken, Rhs: rhs}
+}
+
+func GenUnwrapExpr(receiverVar string) ast.Expr {
+	return GenMethodCall(receiverVar, "Unwrap")
+}
+
+func GenMethodCall(receiver, method string) ast.Expr {
+	return &ast.CallExpr{Fun: &ast.SelectorExpr{X: ast.NewIdent(receiver), Sel: ast.NewIdent(method)}}
+}
+
+func GenIfStmt(cond ast.Expr, stmt ast.Stmt) ast.Stmt {
+	return &ast.IfStmt{Cond: cond, Body: &ast.BlockStmt{List: []ast.Stmt{stmt}}}
+}
+
+func GenReturns(exprs []ast.Expr) ast.Stmt {
+	return &ast.ReturnStmt{Results: exprs}
+}
+
+func GenCallExpr(pkgName, fun string, args []ast.Expr) ast.Expr {
+	return &ast.CallExpr{Fun: lib.QualifiedIdent(pkgName, fun), Args: args}
+}
+
+func GenGenericCallExpr(pkgName, fun string, typeArg ast.Expr, args []ast.Expr) ast.Expr {
+	return &ast.CallExpr{Fun: &ast.IndexExpr{X: lib.QualifiedIdent(pkgName, fun), Index: typeArg}, Args: args}
+}
+
+func GenCompositeLit(pkgName, typ string) ast.Expr {
+	return &ast.CompositeLit{Type: lib.QualifiedIdent(pkgName, typ)}
+}
+
+func importPkgName(info *lib.FileInfo[*QuestionSyntax], addImports map[string]string, pkgPath string) string {
+	pkgName, ok := info.Imports[pkgPath]
+	if !ok {
+		pkgName, ok = addImports[pkgPath]
+	}
+	if !ok {
+		pkgName = lib.GenPkgName(path.Base(pkgPath), pkgPath)
+		addImports[pkgPath] = pkgName
+	}
+	return pkgName
+}
+
+type questionGenerator struct {
+	src        *lib.Source
+	info       *lib.FileInfo[*QuestionSyntax]
+	addImports map[string]string
+	noneErr    string
 }
 
-func GenErrorHandler(resultPkg, resultVar, retType string) string {
-	if len(resultPkg) > 0 {
-		resultPkg += "."
+func (g *questionGenerator) genNoneErr() ast.Expr {
+	idx := strings.LastIndex(g.noneErr, ".")
+	if idx < 0 {
+		return ast.NewIdent(g.noneErr)
 	}
-	return fmt.Sprintf("if %s.IsErr() {\nreturn %sErr[%s](%s.UnwrapErr())\n}\n",
-		resultVar, resultPkg, retType, resultVar)
+	pkgPath, name := g.noneErr[:idx], g.noneErr[idx+1:]
+	if pkgPath == g.info.PkgPath {
+		return ast.NewIdent(name)
+	}
+	return lib.QualifiedIdent(importPkgName(g.info, g.addImports, pkgPath), name)
 }
 
-func GenUnwrapStmt(assignVar, assignToken, receiverVar string) string {
-	return fmt.Sprintf("%s %s %s.Unwrap()\n", assignVar, assignToken, receiverVar)
+func (g *questionGenerator) genFailureReturn(syntax *QuestionSyntax, errExpr func() ast.Expr) (ast.Stmt, error) {
+	retType := syntax.RetType
+	if retType.IsErrorTuple() {
+		var exprs []ast.Expr
+		for _, r := range retType.Results {
+			zero, adds, err := r.Gen(g.info.Imports, g.info.PkgPath)
+			if err != nil {
+				return nil, fmt.Errorf("ZeroValue.Gen() failed: %w", err)
+			}
+			for k, v := range adds {
+				g.addImports[k] = v
+			}
+			exprs = append(exprs, zero)
+		}
+		return GenReturns(append(exprs, errExpr())), nil
+	}
+	innerType, adds := lib.ResetTypeStrPkgName(retType.InnerType, g.info.Imports, g.info.PkgPath)
+	for k, v := range adds {
+		g.addImports[k] = v
+	}
+	innerTypeExpr, err := lib.ParseExpr(innerType)
+	if err != nil {
+		return nil, err
+	}
+	if isResultType(retType.MainType) {
+		return GenReturns([]ast.Expr{
+			GenGenericCallExpr(importPkgName(g.info, g.addImports, resultPkgPath), "Err", innerTypeExpr, []ast.Expr{errExpr()}),
+		}), nil
+	}
+	return GenReturns([]ast.Expr{
+		GenGenericCallExpr(importPkgName(g.info, g.addImports, optionPkgPath), "None", innerTypeExpr, nil),
+	}), nil
 }
 
-func GenUnwrapExpr(receiverVar string) string {
-	return fmt.Sprintf("%s.Unwrap()", receiverVar)
+func (g *questionGenerator) genWrapperPrelude(syntax *QuestionSyntax, needValue bool) ([]ast.Stmt, ast.Expr, error) {
+	args, err := g.src.ExprList(syntax.Call.WrappedArgs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("src.ExprList() failed: %w", err)
+	}
+	var valueNum int
+	switch syntax.Call.Wrapper {
+	case WrapperFrom, WrapperFromComma:
+		valueNum = 1
+	case WrapperFrom2:
+		valueNum = 2
+	case WrapperFrom3:
+		valueNum = 3
+	}
+	var values []string
+	for idx := 0; idx < valueNum; idx++ {
+		if needValue {
+			values = append(values, lib.GenVarName("var", fmt.Sprintf("%s#%d", syntax.Call.Expr, idx)))
+		} else {
+			values = append(values, "_")
+		}
+	}
+
+	var prelude []ast.Stmt
+	var value ast.Expr
+	if syntax.Call.Wrapper == WrapperFromComma {
+		okVar := lib.GenVarName("ok", syntax.Call.Expr.String())
+		failure, err := g.genFailureReturn(syntax, g.genNoneErr)
+		if err != nil {
+			return nil, nil, err
+		}
+		prelude = append(prelude,
+			GenAssginStmt(lib.Idents(append(values, okVar)...), token.DEFINE, args),
+			GenIfStmt(&ast.UnaryExpr{Op: token.NOT, X: ast.NewIdent(okVar)}, failure))
+	} else {
+		errVar := lib.GenVarName("err", syntax.Call.Expr.String())
+		failure, err := g.genFailureReturn(syntax, func() ast.Expr {
+			return ast.NewIdent(errVar)
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		prelude = append(prelude,
+			GenAssginStmt(lib.Idents(append(values, errVar)...), token.DEFINE, args),
+			GenIfStmt(&ast.BinaryExpr{X: ast.NewIdent(errVar), Op: token.NEQ, Y: ast.NewIdent("nil")}, failure))
+	}
+	if needValue {
+		switch syntax.Call.Wrapper {
+		case WrapperFrom, WrapperFromComma:
+			value = ast.NewIdent(values[0])
+		case WrapperFrom2:
+			value = GenCallExpr(importPkgName(g.info, g.addImports, tuplePkgPath), "NewPair", lib.Idents(values...))
+		case WrapperFrom3:
+			value = GenCallExpr(importPkgName(g.info, g.addImports, tuplePkgPath), "NewTriple", lib.Idents(values...))
+		case WrapperFromUnit:
+			value = GenCompositeLit(importPkgName(g.info, g.addImports, sugarPkgPath), "Unit")
+		}
+	}
+	return prelude, value, nil
 }
 
-func GenNoneHandler(optionPkg, optionVar, retType string) string {
-	if len(optionPkg) > 0 {
-		optionPkg += "."
+func (g *questionGenerator) genPrelude(syntax *QuestionSyntax, needValue bool) ([]ast.Stmt, ast.Expr, error) {
+	if len(syntax.Call.Wrapper) > 0 {
+		return g.genWrapperPrelude(syntax, needValue)
+	}
+
+	callExpr, err := g.src.Expr(syntax.Call.Expr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("src.Expr() failed: %w", err)
+	}
+	receiverVar := lib.GenVarName("var", syntax.Call.Expr.String())
+	var cond ast.Expr
+	var failure ast.Stmt
+	if isResultType(lib.GetNameFromTypeStr(syntax.Call.ExprType)) {
+		cond = GenMethodCall(receiverVar, "IsErr")
+		failure, err = g.genFailureReturn(syntax, func() ast.Expr {
+			return GenMethodCall(receiverVar, "UnwrapErr")
+		})
+	} else {
+		cond = GenMethodCall(receiverVar, "IsNone")
+		failure, err = g.genFailureReturn(syntax, g.genNoneErr)
 	}
-	return fmt.Sprintf("if %s.IsNone() {\nreturn %sNone[%s]()\n}\n", optionVar, optionPkg, retType)
+	if err != nil {
+		return nil, nil, err
+	}
+	prelude := []ast.Stmt{
+		GenAssginStmt(lib.Idents(receiverVar), token.DEFINE, []ast.Expr{callExpr}),
+		GenIfStmt(cond, failure),
+	}
+	return prelude, GenUnwrapExpr(receiverVar), nil
 }
 
-func GenerateQuestionSyntax(info *lib.FileInfo[*QuestionSyntax], writer io.Writer) error {
-	return lib.GenerateSyntax(info, writer, func(file *os.File, addImports map[string]string) ([]*lib.ReplaceBlock, error) {
-		var ret []*lib.ReplaceBlock
-		for _, syntax := range info.Syntax {
-			if syntax.Call.AssignVar != nil {
-				assignVar, err := lib.ReadExtent(file, syntax.Call.AssignVar)
-				if err != nil {
-					return nil, fmt.Errorf("ReadExtent() failed: %w", err)
-				}
-				callExpr, err := lib.ReadExtent(file, syntax.Call.Expr)
-				if err != nil {
-					return nil, fmt.Errorf("ReadExtent() failed: %w", err)
-				}
-				receiverVar := lib.GenVarName("var", syntax.Call.Expr.String())
-				retType, adds := lib.ResetTypeStrPkgName(syntax.RetType.InnerType, info.Imports, info.PkgPath)
-				if len(adds) > 0 {
-					for k, v := range adds {
-						addImports[k] = v
-					}
-				}
-				result := GenAssginStmt(receiverVar, token.DEFINE.String(), callExpr)
-				if strings.HasSuffix(lib.GetNameFromTypeStr(syntax.Call.ExprType), "Result") {
-					resultPkg, ok := info.Imports[resultPkgPath]
-					if !ok {
-						resultPkg = lib.GenPkgName(path.Base(resultPkgPath), resultPkgPath)
-						addImports[resultPkgPath] = resultPkg
-					}
-					result += GenErrorHandler(resultPkg, receiverVar, retType)
-				} else {
-					optionPkg, ok := info.Imports[optionPkgPath]
-					if !ok {
-						optionPkg = lib.GenPkgName(path.Base(optionPkgPath), optionPkgPath)
-						addImports[optionPkgPath] = optionPkg
-					}
-					result += GenNoneHandler(optionPkg, receiverVar, retType)
-				}
-				result += GenUnwrapStmt(assignVar, syntax.Call.AssignToken, receiverVar)
-				ret = append(ret, &lib.ReplaceBlock{
-					Old: syntax.Call.Extent,
-					New: result,
-				})
-			} else if syntax.Call.OuterStmt != nil {
-				callExpr, err := lib.ReadExtent(file, syntax.Call.Expr)
-				if err != nil {
-					return nil, fmt.Errorf("ReadExtent() failed: %w", err)
-				}
-				receiverVar := lib.GenVarName("var", syntax.Call.Expr.String())
-				retType, adds := lib.ResetTypeStrPkgName(syntax.RetType.InnerType, info.Imports, info.PkgPath)
-				if len(adds) > 0 {
-					for k, v := range adds {
-						addImports[k] = v
-					}
-				}
-				result := GenAssginStmt(receiverVar, token.DEFINE.String(), callExpr)
-				if strings.HasSuffix(lib.GetNameFromTypeStr(syntax.Call.ExprType), "Result") {
-					resultPkg, ok := info.Imports[resultPkgPath]
-					if !ok {
-						resultPkg = lib.GenPkgName(path.Base(resultPkgPath), resultPkgPath)
-						addImports[resultPkgPath] = resultPkg
-					}
-					result += GenErrorHandler(resultPkg, receiverVar, retType)
-				} else {
-					optionPkg, ok := info.Imports[optionPkgPath]
-					if !ok {
-						optionPkg = lib.GenPkgName(path.Base(optionPkgPath), optionPkgPath)
-						addImports[optionPkgPath] = optionPkg
-					}
-					result += GenNoneHandler(optionPkg, receiverVar, retType)
-				}
-				ret = append(ret,
-					&lib.ReplaceBlock{
-						Old: lib.Extent{
-							Start: syntax.Call.OuterStmt.Start,
-							End:   syntax.Call.OuterStmt.Start,
-						},
-						New: result,
+func stmtNodes(stmts []ast.Stmt) []ast.Node {
+	var ret []ast.Node
+	for _, s := range stmts {
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+func GenerateQuestionSyntax(info *lib.FileInfo[*QuestionSyntax], writer io.Writer, noneErr string) error {
+	return lib.GenerateSyntax(info, writer, func(src *lib.Source, addImports map[string]string) ([]*lib.ReplaceBlock, error) {
+		return EditQuestionSyntax(info, src, addImports, noneErr)
+	})
+}
+
+func EditQuestionSyntax(info *lib.FileInfo[*QuestionSyntax], src *lib.Source, addImports map[string]string, noneErr string) ([]*lib.ReplaceBlock, error) {
+	gen := &questionGenerator{
+		src:        src,
+		info:       info,
+		addImports: addImports,
+		noneErr:    noneErr,
+	}
+	var ret []*lib.ReplaceBlock
+	for _, syntax := range info.Syntax {
+		if syntax.Call.AssignVar != nil {
+			assignVar, err := src.Expr(syntax.Call.AssignVar)
+			if err != nil {
+				return nil, fmt.Errorf("src.Expr() failed: %w", err)
+			}
+			prelude, value, err := gen.genPrelude(syntax, true)
+			if err != nil {
+				return nil, err
+			}
+			assign := GenAssginStmt([]ast.Expr{assignVar}, lib.AssignToken(syntax.Call.AssignToken), []ast.Expr{value})
+			ret = append(ret, &lib.ReplaceBlock{
+				Old: syntax.Call.Extent,
+				New: stmtNodes(append(prelude, assign)),
+			})
+		} else if syntax.Call.OuterStmt != nil {
+			prelude, value, err := gen.genPrelude(syntax, true)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret,
+				&lib.ReplaceBlock{
+					Old: lib.Extent{
+						Start: syntax.Call.OuterStmt.Start,
+						End:   syntax.Call.OuterStmt.Start,
 					},
-					&lib.ReplaceBlock{
-						Old: syntax.Call.Extent,
-						New: GenUnwrapExpr(receiverVar),
-					})
-			} else {
-				callExpr, err := lib.ReadExtent(file, syntax.Call.Expr)
-				if err != nil {
-					return nil, fmt.Errorf("ReadExtent() failed: %w", err)
-				}
-				receiverVar := lib.GenVarName("var", syntax.Call.Expr.String())
-				retType, adds := lib.ResetTypeStrPkgName(syntax.RetType.InnerType, info.Imports, info.PkgPath)
-				if len(adds) > 0 {
-					for k, v := range adds {
-						addImports[k] = v
-					}
-				}
-				result := GenAssginStmt(receiverVar, token.DEFINE.String(), callExpr)
-				if strings.HasSuffix(lib.GetNameFromTypeStr(syntax.Call.ExprType), "Result") {
-					resultPkg, ok := info.Imports[resultPkgPath]
-					if !ok {
-						resultPkg = lib.GenPkgName(path.Base(resultPkgPath), resultPkgPath)
-						addImports[resultPkgPath] = resultPkg
-					}
-					result += GenErrorHandler(resultPkg, receiverVar, retType)
-				} else {
-					optionPkg, ok := info.Imports[optionPkgPath]
-					if !ok {
-						optionPkg = lib.GenPkgName(path.Base(optionPkgPath), optionPkgPath)
-						addImports[optionPkgPath] = optionPkg
-					}
-					result += GenNoneHandler(optionPkg, receiverVar, retType)
-				}
-				ret = append(ret, &lib.ReplaceBlock{
+					New: stmtNodes(prelude),
+				},
+				&lib.ReplaceBlock{
 					Old: syntax.Call.Extent,
-					New: result,
+					New: []ast.Node{value},
 				})
+		} else {
+			prelude, _, err := gen.genPrelude(syntax, false)
+			if err != nil {
+				return nil, err
 			}
+			ret = append(ret, &lib.ReplaceBlock{
+				Old: syntax.Call.Extent,
+				New: stmtNodes(prelude),
+			})
 		}
-		return ret, nil
-	})
+	}
+	return ret, nil
 }
 
-type Translator struct{}
+type Translator struct {
+	NoneErr string
+}
+
+// ParseNoneErr checks that s names an error variable, either an identifier of the package
+// being transformed or an exported one qualified by its import path, e.g. io.EOF.
+func ParseNoneErr(s string) (string, error) {
+	name := s
+	if idx := strings.LastIndex(s, "."); idx >= 0 {
+		pkgPath := s[:idx]
+		name = s[idx+1:]
+		if err := module.CheckImportPath(pkgPath); err != nil {
+			return "", fmt.Errorf("invalid none error %q: %w", s, err)
+		}
+		if !token.IsExported(name) {
+			return "", fmt.Errorf("invalid none error %q: %s is not exported", s, name)
+		}
+	}
+	if !token.IsIdentifier(name) {
+		return "", fmt.Errorf("invalid none error %q: it must be an identifier qualified by an import path, e.g. io.EOF", s)
+	}
+	return s, nil
+}
 
 func (*Translator) InpectTypes(p *packages.Package) []*QuestionInstanceType {
+	// the imports of a package in a go/analysis pass have no syntax
+	if len(p.Syntax) <= 0 && p.Types != nil {
+		return InspectPackageTypes(p.Types)
+	}
 	return NewQuestionTypeInspector(p).Inspect()
 }
 
@@ -478,12 +794,28 @@ func (*Translator) InspectSyntax(p *packages.Package, instTypes []*QuestionInsta
 	return NewQuestionSyntaxInspector(p, instTypes)
 }
 
-func (*Translator) Generate(info *lib.FileInfo[*QuestionSyntax], writer io.Writer) error {
-	return GenerateQuestionSyntax(info, writer)
+func (t *Translator) Generate(info *lib.FileInfo[*QuestionSyntax], writer io.Writer) error {
+	noneErr := t.NoneErr
+	if len(noneErr) <= 0 {
+		noneErr = defaultNoneErr
+	}
+	return GenerateQuestionSyntax(info, writer, noneErr)
+}
+
+func (t *Translator) Edit(info *lib.FileInfo[*QuestionSyntax], src *lib.Source, addImports map[string]string) ([]*lib.ReplaceBlock, error) {
+	noneErr := t.NoneErr
+	if len(noneErr) <= 0 {
+		noneErr = defaultNoneErr
+	}
+	return EditQuestionSyntax(info, src, addImports, noneErr)
+}
+
+func (t *Translator) Translation() lib.Translation {
+	return lib.NewTranslation[*QuestionInstanceType, *QuestionSyntax](t)
 }
 
-func (t *Translator) Run(ctx context.Context, rootDir string, firstRun bool) error {
-	err := lib.TranslateSyntax(ctx, rootDir, firstRun, t)
+func (t *Translator) Run(ctx context.Context, cfg *lib.Config, firstRun bool) error {
+	err := lib.TranslateSyntax(ctx, cfg, firstRun, t)
 	if err != nil {
 		return fmt.Errorf("translate question syntax failed: %w", err)
 	}
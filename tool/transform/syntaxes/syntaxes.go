@@ -0,0 +1,25 @@
+// Package syntaxes registers the built-in syntaxes of the transform tool, it is imported for its side effect.
+package syntaxes
+
+import (
+	"github.com/arcane-craft/sugar/tool/transform/exception"
+	"github.com/arcane-craft/sugar/tool/transform/lib"
+	"github.com/arcane-craft/sugar/tool/transform/predef"
+	"github.com/arcane-craft/sugar/tool/transform/question"
+	"github.com/arcane-craft/sugar/tool/transform/tryfunc"
+)
+
+const (
+	SyntaxQuestionMark = question.SyntaxName
+	SyntaxException    = exception.SyntaxName
+	SyntaxTryFunc      = tryfunc.SyntaxName
+	SyntaxPredefine    = predef.SyntaxName
+)
+
+// the order of registration is the order the syntaxes are lowered in
+func init() {
+	lib.RegisterSyntax(SyntaxQuestionMark, new(question.Translator))
+	lib.RegisterSyntax(SyntaxException, new(exception.Translator))
+	lib.RegisterSyntax(SyntaxTryFunc, new(tryfunc.Translator))
+	lib.RegisterSyntax(SyntaxPredefine, new(predef.Translator))
+}
@@ -0,0 +1,41 @@
+//go:build !sugar_production
+
+package combined
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/arcane-craft/sugar/result"
+	. "github.com/arcane-craft/sugar/syntax/exception"
+	"github.com/arcane-craft/sugar/syntax/tryfunc"
+)
+
+// the errors of Try() in a Try block are caught, Q() in a Catch body returns from Port
+func Port(name string) (int, error) {
+	Try(func() {
+		file := tryfunc.Try(os.Open(name))
+		defer file.Close()
+		content := tryfunc.Try(io.ReadAll(file))
+		port, _ := strconv.Atoi(string(content))
+		Return(port)
+	}).Catch(Error(os.ErrNotExist), func(err error) {
+		port := result.From(strconv.Atoi(os.Getenv("PORT"))).Q()
+		Return(port)
+	}).Finally(func() {
+		fmt.Println("port resolved")
+	})
+	return 0, nil
+}
+
+func Copy(dst, src string) error {
+	content := tryfunc.Try(os.ReadFile(src))
+	Try(func() {
+		tryfunc.Try_(os.WriteFile(dst, content, 0644))
+	}).Finally(func() {
+		tryfunc.Try_(os.Chmod(dst, 0600))
+	})
+	return nil
+}
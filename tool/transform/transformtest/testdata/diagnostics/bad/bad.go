@@ -0,0 +1,13 @@
+//go:build !sugar_production
+
+package bad
+
+import (
+	"os"
+
+	. "github.com/arcane-craft/sugar/syntax/tryfunc"
+)
+
+func Remove(name string) {
+	Try_(os.Remove(name))
+}
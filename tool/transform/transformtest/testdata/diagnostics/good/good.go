@@ -0,0 +1,14 @@
+//go:build !sugar_production
+
+package good
+
+import (
+	"os"
+
+	. "github.com/arcane-craft/sugar/syntax/tryfunc"
+)
+
+func Remove(name string) error {
+	Try_(os.Remove(name))
+	return nil
+}
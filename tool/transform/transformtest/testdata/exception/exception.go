@@ -0,0 +1,65 @@
+//go:build !sugar_production
+
+package exception
+
+import (
+	"fmt"
+	"os"
+
+	. "github.com/arcane-craft/sugar/syntax/exception"
+)
+
+func Read(name string) ([]byte, error) {
+	Try(func() {
+		content, _ := os.ReadFile(name)
+		Return(content)
+	}).Catch(Type[*os.PathError](), func(err error) {
+		fmt.Println("error occured:", err)
+		Throw(err)
+	})
+	return nil, nil
+}
+
+func Count(name string) (int, error) {
+	Try(func() {
+		content, _ := os.ReadFile(name)
+		Return(len(content))
+	}).Catch(Error(os.ErrNotExist), func(err error) {
+		fmt.Println("file not found:", err)
+	}).Finally(func() {
+		fmt.Println("count finished")
+	})
+	return 0, nil
+}
+
+func CountOrZero(name string) (int, error) {
+	Try(func() {
+		content, _ := os.ReadFile(name)
+		Return(len(content))
+	}).Catch(Error(os.ErrNotExist), func(err error) {
+		fmt.Println("file not found:", err)
+	}).Finally(func() {
+		Return(0)
+	})
+	return 0, nil
+}
+
+func Remove(name string) error {
+	Try(func() {
+		_ = os.Remove(name)
+	}).Catch(Error(os.ErrNotExist), func(err error) {
+		fmt.Println("file not found:", err)
+	}).Finally(func() {
+		Throw(fmt.Errorf("remove %s finished", name))
+	})
+	return nil
+}
+
+func Write(name string, content []byte) error {
+	Try(func() {
+		_ = os.WriteFile(name, content, 0644)
+	}).Finally(func() {
+		fmt.Println("write finished")
+	})
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !sugar_production
+
+package predef
+
+import (
+	. "github.com/arcane-craft/sugar/syntax/predef"
+)
+
+func Where() (string, string, string, string) {
+	return Function__, PrettyFunction__, Package__, Line__
+}
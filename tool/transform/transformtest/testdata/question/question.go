@@ -0,0 +1,26 @@
+//go:build !sugar_production
+
+package question
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/arcane-craft/sugar/option"
+	. "github.com/arcane-craft/sugar/result"
+)
+
+func ReadFile(name string) Result[string] {
+	content := From(os.ReadFile(name)).Q()
+	return Ok(string(content))
+}
+
+func Port() Result[int] {
+	port := From(strconv.Atoi(os.Getenv("PORT"))).Q()
+	return Ok(port)
+}
+
+func Home() option.Option[string] {
+	home := option.FromComma(os.LookupEnv("HOME")).Q()
+	return option.Some(home)
+}
@@ -0,0 +1,7 @@
+module example.com/tryfunc
+
+go 1.21
+
+require github.com/arcane-craft/sugar v0.0.0
+
+replace github.com/arcane-craft/sugar => ../../../../..
@@ -0,0 +1,25 @@
+//go:build !sugar_production
+
+package tryfunc
+
+import (
+	"io"
+	"os"
+
+	. "github.com/arcane-craft/sugar/syntax/tryfunc"
+)
+
+func Read(name string) ([]byte, error) {
+	file := Try(os.Open(name))
+	defer file.Close()
+	content := Try(io.ReadAll(file))
+	return content, nil
+}
+
+// Remove does not wrap its errors whatever the mode of the tool
+//
+//sugar:try-wrap none
+func Remove(name string) error {
+	Try_(os.Remove(name))
+	return nil
+}
@@ -0,0 +1,179 @@
+// Package transformtest runs syntax translators over fixture modules in tests.
+//
+// A fixture is a directory inside a module with its own go.mod, usually under
+// testdata. Run copies it into a temporary directory and transforms the copy, so
+// the fixture itself is never modified:
+//
+//	func TestMySyntax(t *testing.T) {
+//		r := transformtest.Run(t, "testdata/mysyntax", mySyntaxProgram)
+//		r.ExpectDiagnostics(t)
+//		r.Golden(t, "testdata/mysyntax.golden")
+//		r.Build(t)
+//	}
+//
+// Set SUGAR_UPDATE_GOLDEN=1 to rewrite the golden files from the generated ones.
+package transformtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/arcane-craft/sugar/tool/transform/lib"
+)
+
+const updateEnv = "SUGAR_UPDATE_GOLDEN"
+
+type Result struct {
+	// the transformed copy of the fixture
+	Root string
+	// positions refer to the fixture, not to the copy
+	Diagnostics lib.Diagnostics
+	// generated files and their position maps by slash-separated path relative to Root
+	Generated map[string][]byte
+
+	fixture string
+}
+
+func Run(t testing.TB, dir string, programs ...lib.Program) *Result {
+	t.Helper()
+	if slices.Contains(programs, nil) {
+		t.Fatal("transformtest.Run program is nil")
+	}
+	fixture, err := filepath.Abs(dir)
+	if err != nil {
+		t.Fatalf("filepath.Abs() failed: %v", err)
+	}
+	var diagnostics lib.Diagnostics
+	root, err := lib.OutOfTree(context.Background(), fixture, t.TempDir(), func(ctx context.Context, rootDir string) error {
+		diags, err := lib.Transform(ctx, &lib.Config{RootDir: rootDir}, programs)
+		if err != nil {
+			return err
+		}
+		if len(diags) > 0 {
+			return diags
+		}
+		return nil
+	})
+	if err != nil && !errors.As(err, &diagnostics) {
+		t.Fatalf("transform %s failed: %v", dir, err)
+	}
+	diagnostics.Sort()
+
+	generated := make(map[string][]byte)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if !lib.IsProductionFile(path) && !lib.IsProductionFile(strings.TrimSuffix(path, ".map")) {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		generated[filepath.ToSlash(rel)] = content
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("collect generated files failed: %v", err)
+	}
+	return &Result{Root: root, Diagnostics: diagnostics, Generated: generated, fixture: fixture}
+}
+
+// ExpectDiagnostics fails the test unless the diagnostics are exactly the given ones,
+// each written as "file:line:col: syntax: reason" with file relative to the fixture.
+func (r *Result) ExpectDiagnostics(t testing.TB, want ...string) {
+	t.Helper()
+	var got []string
+	for _, d := range r.Diagnostics {
+		pos := d.Pos
+		if rel, err := filepath.Rel(r.fixture, pos.Filename); err == nil {
+			pos.Filename = filepath.ToSlash(rel)
+		}
+		got = append(got, fmt.Sprintf("%s: %s: %s", pos, d.Syntax, d.Reason))
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("unexpected diagnostics\ngot:\n\t%s\nwant:\n\t%s", strings.Join(got, "\n\t"), strings.Join(want, "\n\t"))
+	}
+}
+
+// Golden compares each generated file with <path>.golden in goldenDir, and fails for
+// golden files without a generated counterpart.
+func (r *Result) Golden(t testing.TB, goldenDir string) {
+	t.Helper()
+	if len(os.Getenv(updateEnv)) > 0 {
+		if err := os.RemoveAll(goldenDir); err != nil {
+			t.Fatalf("os.RemoveAll() failed: %v", err)
+		}
+		for rel, content := range r.Generated {
+			path := filepath.Join(goldenDir, filepath.FromSlash(rel)+".golden")
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatalf("os.MkdirAll() failed: %v", err)
+			}
+			if err := os.WriteFile(path, content, 0644); err != nil {
+				t.Fatalf("os.WriteFile() failed: %v", err)
+			}
+		}
+		return
+	}
+
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(goldenDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".golden") {
+			return err
+		}
+		rel, err := filepath.Rel(goldenDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(strings.TrimSuffix(rel, ".golden"))
+		seen[rel] = true
+		want, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		got, ok := r.Generated[rel]
+		if !ok {
+			t.Errorf("%s was not generated", rel)
+		} else if !bytes.Equal(got, want) {
+			t.Errorf("%s differs from %s (set %s=1 to update)\ngot:\n%s", rel, path, updateEnv, got)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("read golden files failed: %v", err)
+	}
+	for rel := range r.Generated {
+		if !seen[rel] {
+			t.Errorf("%s has no golden file in %s (set %s=1 to update)", rel, goldenDir, updateEnv)
+		}
+	}
+}
+
+// Build checks that the transformed copy builds and vets with the production tag.
+func (r *Result) Build(t testing.TB) {
+	t.Helper()
+	for _, args := range [][]string{
+		{"build", "-tags", "sugar_production", "./..."},
+		{"vet", "-tags", "sugar_production", "./..."},
+	} {
+		cmd := exec.Command("go", args...)
+		cmd.Dir = r.Root
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("go %s failed: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+}
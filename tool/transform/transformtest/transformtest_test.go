@@ -0,0 +1,78 @@
+package transformtest_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/arcane-craft/sugar/tool/transform/exception"
+	"github.com/arcane-craft/sugar/tool/transform/lib"
+	"github.com/arcane-craft/sugar/tool/transform/predef"
+	"github.com/arcane-craft/sugar/tool/transform/question"
+	_ "github.com/arcane-craft/sugar/tool/transform/syntaxes"
+	"github.com/arcane-craft/sugar/tool/transform/transformtest"
+	"github.com/arcane-craft/sugar/tool/transform/tryfunc"
+)
+
+func TestQuestion(t *testing.T) {
+	r := transformtest.Run(t, "testdata/question", new(question.Translator))
+	r.ExpectDiagnostics(t)
+	r.Golden(t, "testdata/question.golden")
+	r.Build(t)
+}
+
+func TestException(t *testing.T) {
+	r := transformtest.Run(t, "testdata/exception", new(exception.Translator))
+	r.ExpectDiagnostics(t)
+	r.Golden(t, "testdata/exception.golden")
+	r.Build(t)
+}
+
+func TestTryFunc(t *testing.T) {
+	r := transformtest.Run(t, "testdata/tryfunc", &tryfunc.Translator{Wrap: tryfunc.WrapFunc})
+	r.ExpectDiagnostics(t)
+	r.Golden(t, "testdata/tryfunc.golden")
+	r.Build(t)
+}
+
+// the call mode embeds the path of the source, so it is not compared with a golden file
+func TestTryFuncWrapCall(t *testing.T) {
+	r := transformtest.Run(t, "testdata/tryfunc", &tryfunc.Translator{Wrap: tryfunc.WrapCall})
+	r.ExpectDiagnostics(t)
+	content := r.Generated["tryfunc_sugar_production.go"]
+	if n := bytes.Count(content, []byte(`"%s:%d: %s: %w"`)); n != 2 {
+		t.Errorf("got %d wrapped calls, want 2\n%s", n, content)
+	}
+	r.Build(t)
+}
+
+func TestPredef(t *testing.T) {
+	r := transformtest.Run(t, "testdata/predef", new(predef.Translator))
+	r.ExpectDiagnostics(t)
+	r.Golden(t, "testdata/predef.golden")
+	r.Build(t)
+}
+
+func TestDiagnostics(t *testing.T) {
+	r := transformtest.Run(t, "testdata/diagnostics", new(tryfunc.Translator))
+	r.ExpectDiagnostics(t,
+		"bad/bad.go:12:2: try_func: Try_() requires the enclosing function to have error as its last result",
+	)
+	for rel := range r.Generated {
+		if strings.HasPrefix(rel, "bad/") {
+			t.Errorf("%s was generated for a package with diagnostics", rel)
+		}
+	}
+	r.Golden(t, "testdata/diagnostics.golden")
+}
+
+func TestCombined(t *testing.T) {
+	programs, err := lib.Programs(nil, nil)
+	if err != nil {
+		t.Fatalf("lib.Programs() failed: %v", err)
+	}
+	r := transformtest.Run(t, "testdata/combined", programs...)
+	r.ExpectDiagnostics(t)
+	r.Golden(t, "testdata/combined.golden")
+	r.Build(t)
+}
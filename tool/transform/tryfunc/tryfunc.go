@@ -6,20 +6,45 @@ import (
 	"go/ast"
 	"go/token"
 	"io"
-	"os"
+	"strconv"
 	"strings"
 
+	"github.com/arcane-craft/sugar/tool/transform/exception"
 	"github.com/arcane-craft/sugar/tool/transform/lib"
 	"golang.org/x/tools/go/packages"
 )
 
+const SyntaxName = "try_func"
+
 const (
 	errorTypeName  = "error"
 	tryFuncPkgPath = "github.com/arcane-craft/sugar/syntax/tryfunc"
 	tryFuncName    = "Try"
 	stdFmtPkgPath  = "fmt"
+	// overrides the wrapping mode of the calls in a function, e.g. //sugar:try-wrap call
+	wrapDirective = "//sugar:try-wrap"
+)
+
+// WrapMode decides how the errors returned by Try calls are wrapped.
+type WrapMode string
+
+const (
+	// errors are returned as they are
+	WrapNone WrapMode = "none"
+	// a deferred call prefixes the error returned by the function with its signature
+	WrapFunc WrapMode = "func"
+	// each call prefixes its error with its position and callee
+	WrapCall WrapMode = "call"
 )
 
+func ParseWrapMode(s string) (WrapMode, error) {
+	switch mode := WrapMode(s); mode {
+	case WrapNone, WrapFunc, WrapCall:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown error wrapping mode %q, available modes: %s, %s, %s", s, WrapNone, WrapFunc, WrapCall)
+}
+
 type TryStmt struct {
 	*lib.Extent
 	RetVars     []*lib.Extent
@@ -46,22 +71,28 @@ func (f *FuncResult) String() string {
 type TrySyntax struct {
 	*lib.Extent
 	OuterFunc string
+	FirstStmt *lib.Extent
 	Stmts     []*TryStmt
 	Results   []*FuncResult
+	// empty if the function has no directive
+	Wrap WrapMode
 }
 
 func (t *TrySyntax) String() string {
-	return fmt.Sprintf("%s, Stmts: %s, Results: %s",
-		t.Extent, lib.JoinStringers(t.Stmts, ","), lib.JoinStringers(t.Results, ","))
+	return fmt.Sprintf("%s, Stmts: %s, Results: %s, Wrap: %s",
+		t.Extent, lib.JoinStringers(t.Stmts, ","), lib.JoinStringers(t.Results, ","), t.Wrap)
 }
 
 type SyntaxInspector struct {
-	pkg *packages.Package
+	pkg             *packages.Package
+	exceptionBlocks map[*ast.FuncLit]bool
+	diagnostics     lib.DiagnosticSet
 }
 
 func NewSyntaxInspector(pkg *packages.Package) *SyntaxInspector {
 	return &SyntaxInspector{
-		pkg: pkg,
+		pkg:             pkg,
+		exceptionBlocks: exception.BlockLiterals(pkg),
 	}
 }
 
@@ -127,30 +158,37 @@ func (i *SyntaxInspector) getFuncIdent(expr ast.Expr) *ast.Ident {
 	return nil
 }
 
-func (i *SyntaxInspector) inspectTryFuncCall(expr ast.Expr) (ast.Expr, int, bool) {
+func (i *SyntaxInspector) findTryFuncCall(expr ast.Expr) (*ast.CallExpr, *ast.Ident) {
 	if call, ok := expr.(*ast.CallExpr); ok {
 		funcIdent := i.getFuncIdent(call.Fun)
 		if funcIdent != nil && strings.HasPrefix(funcIdent.Name, tryFuncName) {
 			object := i.pkg.TypesInfo.ObjectOf(funcIdent)
 			if object != nil &&
 				object.Pkg() != nil &&
-				object.Pkg().Path() == tryFuncPkgPath &&
-				len(call.Args) == 1 {
-				var retNum int
-				switch strings.TrimPrefix(funcIdent.Name, tryFuncName) {
-				case "_":
-					retNum = 0
-				case "":
-					retNum = 1
-				case "2":
-					retNum = 2
-				case "3":
-					retNum = 3
-				}
-				return call.Args[0], retNum, true
+				object.Pkg().Path() == tryFuncPkgPath {
+				return call, funcIdent
 			}
 		}
 	}
+	return nil, nil
+}
+
+func (i *SyntaxInspector) inspectTryFuncCall(expr ast.Expr) (ast.Expr, int, bool) {
+	call, funcIdent := i.findTryFuncCall(expr)
+	if call != nil && len(call.Args) == 1 {
+		var retNum int
+		switch strings.TrimPrefix(funcIdent.Name, tryFuncName) {
+		case "_":
+			retNum = 0
+		case "":
+			retNum = 1
+		case "2":
+			retNum = 2
+		case "3":
+			retNum = 3
+		}
+		return call.Args[0], retNum, true
+	}
 	return nil, 0, false
 }
 
@@ -222,60 +260,158 @@ func (i *SyntaxInspector) findTryStmt(node ast.Stmt, outer ast.Stmt) (ret *TrySt
 }
 
 func (i *SyntaxInspector) inspectFunc(typ *ast.FuncType, body *ast.BlockStmt) *TrySyntax {
+	if body == nil {
+		return nil
+	}
 	funcResults := i.findFuncResults(typ)
-	if len(funcResults) > 0 {
-		var outerStmt ast.Stmt
-		var calls []*TryStmt
-		ast.Inspect(body, func(child ast.Node) bool {
-			if _, ok := child.(*ast.FuncLit); ok {
-				return false
-			}
-			stmt, ok := child.(ast.Stmt)
-			if !ok {
-				return true
+	var outerStmt ast.Stmt
+	var calls []*TryStmt
+	ast.Inspect(body, func(child ast.Node) bool {
+		if lit, ok := child.(*ast.FuncLit); ok {
+			i.inspectLit(lit)
+			return false
+		}
+		if expr, ok := child.(ast.Expr); ok {
+			if call, funcIdent := i.findTryFuncCall(expr); call != nil {
+				i.reportMisuse(call, funcIdent, len(funcResults) > 0)
 			}
+			return true
+		}
+		stmt, ok := child.(ast.Stmt)
+		if !ok {
+			return true
+		}
+		if len(funcResults) > 0 {
 			funcStmt := i.findTryStmt(stmt, outerStmt)
 			if funcStmt != nil {
 				calls = append(calls, funcStmt)
 				outerStmt = nil
 				return false
 			}
-			outerStmt = stmt
-			return true
-		})
-		if len(calls) > 0 {
-			return &TrySyntax{
-				Extent: &lib.Extent{
-					Start: i.pkg.Fset.Position(body.Pos() + 1),
-					End:   i.pkg.Fset.Position(body.End() - 1),
-				},
-				Stmts:   calls,
-				Results: funcResults,
-			}
+		}
+		outerStmt = stmt
+		return true
+	})
+	if len(calls) > 0 {
+		return &TrySyntax{
+			Extent: &lib.Extent{
+				Start: i.pkg.Fset.Position(body.Pos() + 1),
+				End:   i.pkg.Fset.Position(body.End() - 1),
+			},
+			FirstStmt: &lib.Extent{
+				Start: i.pkg.Fset.Position(body.List[0].Pos()),
+				End:   i.pkg.Fset.Position(body.List[0].End()),
+			},
+			Stmts:   calls,
+			Results: funcResults,
 		}
 	}
 	return nil
 }
 
-func (i *SyntaxInspector) Inspect(node ast.Node, _ []ast.Node) *TrySyntax {
+func (i *SyntaxInspector) reportMisuse(call *ast.CallExpr, funcIdent *ast.Ident, returnsError bool) {
+	var reason string
+	switch {
+	case len(call.Args) != 1:
+		reason = fmt.Sprintf("%s() must take a single function call returning error as its last result", funcIdent.Name)
+	case !returnsError:
+		reason = fmt.Sprintf("%s() requires the enclosing function to have error as its last result", funcIdent.Name)
+	default:
+		reason = fmt.Sprintf("%s() must be used as an expression statement or as the single right-hand side of an assignment", funcIdent.Name)
+	}
+	i.diagnostics.Add(&lib.Diagnostic{
+		Pos:    i.pkg.Fset.Position(call.Pos()),
+		Syntax: SyntaxName,
+		Reason: reason,
+	})
+}
+
+func (i *SyntaxInspector) Diagnostics() lib.Diagnostics {
+	return i.diagnostics.Diagnostics()
+}
+
+func (i *SyntaxInspector) wrapMode(doc *ast.CommentGroup) WrapMode {
+	if doc == nil {
+		return ""
+	}
+	for _, c := range doc.List {
+		arg, ok := strings.CutPrefix(c.Text, wrapDirective)
+		if !ok || len(arg) > 0 && arg[0] != ' ' && arg[0] != '\t' {
+			continue
+		}
+		mode, err := ParseWrapMode(strings.TrimSpace(arg))
+		if err != nil {
+			i.diagnostics.Add(&lib.Diagnostic{
+				Pos:    i.pkg.Fset.Position(c.Pos()),
+				Syntax: SyntaxName,
+				Reason: err.Error(),
+			})
+			return ""
+		}
+		return mode
+	}
+	return ""
+}
+
+func (i *SyntaxInspector) inspectLit(lit *ast.FuncLit) {
+	if !i.exceptionBlocks[lit] {
+		i.inspectFunc(lit.Type, lit.Body)
+		return
+	}
+	// the statements calling Try() in a block of the exception syntax are lowered with the block
+	ast.Inspect(lit.Body, func(child ast.Node) bool {
+		if lit, ok := child.(*ast.FuncLit); ok {
+			i.inspectLit(lit)
+			return false
+		}
+		if expr, ok := child.(ast.Expr); ok {
+			if call, funcIdent := i.findTryFuncCall(expr); call != nil {
+				i.reportMisuse(call, funcIdent, true)
+			}
+			return true
+		}
+		if stmt, ok := child.(ast.Stmt); ok && i.findTryStmt(stmt, nil) != nil {
+			return false
+		}
+		return true
+	})
+}
+
+func (i *SyntaxInspector) Inspect(node ast.Node, stack []ast.Node) *TrySyntax {
 	var syntax *TrySyntax
 	var outerFunc string
+	var wrap WrapMode
 	switch fun := node.(type) {
 	case *ast.FuncDecl:
 		syntax = i.inspectFunc(fun.Type, fun.Body)
 		outerFunc = i.pkg.TypesInfo.TypeOf(fun.Name).String()
 		outerFunc = strings.Replace(outerFunc, "func", fmt.Sprintf("func %s", fun.Name), 1)
+		wrap = i.wrapMode(fun.Doc)
 	case *ast.FuncLit:
+		if i.exceptionBlocks[fun] {
+			return nil
+		}
 		syntax = i.inspectFunc(fun.Type, fun.Body)
 		outerFunc = i.pkg.TypesInfo.TypeOf(fun).String()
+		// function literals follow the directive of the declaration they are in
+		for idx := len(stack) - 1; idx >= 0; idx-- {
+			if decl, ok := stack[idx].(*ast.FuncDecl); ok {
+				wrap = i.wrapMode(decl.Doc)
+				break
+			}
+		}
 	}
 	if syntax != nil {
 		syntax.OuterFunc = outerFunc
+		syntax.Wrap = wrap
 	}
 	return syntax
 }
 
-type Translator struct{}
+type Translator struct {
+	// Wrap applies to the functions without a directive, WrapNone if empty
+	Wrap WrapMode
+}
 
 func (*Translator) InpectTypes(p *packages.Package) []*lib.Extent {
 	return nil
@@ -285,122 +421,192 @@ func (*Translator) InspectSyntax(p *packages.Package, _ []*lib.Extent) lib.Synta
 	return NewSyntaxInspector(p)
 }
 
-func genFuncResultTypeElem(name, typ string) string {
-	return fmt.Sprintf("%s %s", name, typ)
+func genFuncResultTypeElem(name string, typ ast.Expr) *ast.Field {
+	return &ast.Field{Names: []*ast.Ident{ast.NewIdent(name)}, Type: typ}
 }
 
-func genFuncResultType(elems []string) string {
-	return strings.Join(elems, ", ")
+func genAssignStmt(lhs []ast.Expr, tok token.Token, callExpr ast.Expr) ast.Stmt {
+	return &ast.AssignStmt{Lhs: lhs, Tok: tok, Rhs: []ast.Expr{callExpr}}
 }
 
-func genAssignStmt(lhs []string, token, callExpr string) string {
-	return fmt.Sprintf("%s %s %s", strings.Join(lhs, ", "), token, callExpr)
+// a nil wrap returns the error as it is
+func genErrHander(errVar string, retErrVar string, wrap ast.Expr) ast.Stmt {
+	var stmts []ast.Stmt
+	if wrap != nil {
+		stmts = append(stmts, &ast.AssignStmt{Lhs: lib.Idents(retErrVar), Tok: token.ASSIGN, Rhs: []ast.Expr{wrap}})
+	} else if errVar != retErrVar {
+		stmts = append(stmts, &ast.AssignStmt{Lhs: lib.Idents(retErrVar), Tok: token.ASSIGN, Rhs: lib.Idents(errVar)})
+	}
+	stmts = append(stmts, &ast.ReturnStmt{})
+	return &ast.IfStmt{
+		Cond: &ast.BinaryExpr{X: ast.NewIdent(errVar), Op: token.NEQ, Y: ast.NewIdent("nil")},
+		Body: &ast.BlockStmt{List: stmts},
+	}
 }
 
-func genErrHander(errVar string, retErrVar string) string {
-	var stmts []string
-	if errVar != retErrVar {
-		stmts = append(stmts, fmt.Sprintf("%s = %s", retErrVar, errVar))
+func genErrWraper(retErrVar, fmtPkg, outerFunc string) ast.Stmt {
+	wrap := &ast.AssignStmt{
+		Lhs: lib.Idents(retErrVar),
+		Tok: token.ASSIGN,
+		Rhs: []ast.Expr{&ast.CallExpr{
+			Fun: lib.QualifiedIdent(fmtPkg, "Errorf"),
+			Args: []ast.Expr{
+				&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(outerFunc + ": %w")},
+				ast.NewIdent(retErrVar),
+			},
+		}},
 	}
-	stmts = append(stmts, "return")
-	return fmt.Sprintf("if %s != nil {\n %s \n}", errVar, strings.Join(stmts, "\n"))
+	return &ast.DeferStmt{Call: &ast.CallExpr{Fun: &ast.FuncLit{
+		Type: &ast.FuncType{Params: &ast.FieldList{}},
+		Body: &ast.BlockStmt{List: []ast.Stmt{&ast.IfStmt{
+			Cond: &ast.BinaryExpr{X: ast.NewIdent(retErrVar), Op: token.NEQ, Y: ast.NewIdent("nil")},
+			Body: &ast.BlockStmt{List: []ast.Stmt{wrap}},
+		}}},
+	}}}
 }
 
-func genErrWraper(retErrVar, fmtPkg, outerFunc string) string {
-	if len(fmtPkg) > 0 {
-		fmtPkg += "."
+func genCallWrap(errVar, fmtPkg string, pos token.Position, callee string) ast.Expr {
+	return &ast.CallExpr{
+		Fun: lib.QualifiedIdent(fmtPkg, "Errorf"),
+		Args: []ast.Expr{
+			&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote("%s:%d: %s: %w")},
+			&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(pos.Filename)},
+			&ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(pos.Line)},
+			&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(callee)},
+			ast.NewIdent(errVar),
+		},
 	}
-	return fmt.Sprintf("defer func() {\n if %s != nil {\n %s = %sErrorf(\"%s: %%w\", %s) \n} \n}()", retErrVar, retErrVar, fmtPkg, outerFunc, retErrVar)
-}
-
-func (*Translator) Generate(info *lib.FileInfo[*TrySyntax], writer io.Writer) error {
-	return lib.GenerateSyntax(info, writer, func(file *os.File, addImports map[string]string) ([]*lib.ReplaceBlock, error) {
-		var blocks []*lib.ReplaceBlock
-		for _, syntax := range info.Syntax {
-			var resultTypeElems []string
-			var resultStart, resultEnd token.Position
-			var retErrVar string
-			for idx, ret := range syntax.Results {
-				elemType, err := lib.ReadExtent(file, ret.Type)
-				if err != nil {
-					return nil, fmt.Errorf("lib.ReadExtent() failed: %w", err)
-				}
-				if resultStart.Offset <= 0 || ret.Start.Offset < resultStart.Offset {
-					resultStart = ret.Start
-				}
-				if ret.End.Offset > resultEnd.Offset {
-					resultEnd = ret.End
-				}
-				resultTypeElems = append(resultTypeElems, genFuncResultTypeElem(ret.Name, elemType))
-				if idx == len(syntax.Results)-1 {
-					retErrVar = ret.Name
-				}
+}
+
+func (t *Translator) Generate(info *lib.FileInfo[*TrySyntax], writer io.Writer) error {
+	return lib.GenerateSyntax(info, writer, func(src *lib.Source, addImports map[string]string) ([]*lib.ReplaceBlock, error) {
+		return t.Edit(info, src, addImports)
+	})
+}
+
+func (t *Translator) Edit(info *lib.FileInfo[*TrySyntax], src *lib.Source, addImports map[string]string) ([]*lib.ReplaceBlock, error) {
+	var blocks []*lib.ReplaceBlock
+	fmtPkg := func() string {
+		pkgName, ok := info.Imports[stdFmtPkgPath]
+		if !ok {
+			pkgName = lib.GenPkgName(stdFmtPkgPath, stdFmtPkgPath)
+			addImports[stdFmtPkgPath] = pkgName
+		}
+		return pkgName
+	}
+	for _, syntax := range info.Syntax {
+		wrap := syntax.Wrap
+		if len(wrap) <= 0 {
+			wrap = t.Wrap
+		}
+		var resultTypeElems []ast.Node
+		var resultStart, resultEnd token.Position
+		var retErrVar string
+		for idx, ret := range syntax.Results {
+			elemType, err := src.Expr(ret.Type)
+			if err != nil {
+				return nil, fmt.Errorf("src.Expr() failed: %w", err)
+			}
+			if resultStart.Offset <= 0 || ret.Start.Offset < resultStart.Offset {
+				resultStart = ret.Start
 			}
+			if ret.End.Offset > resultEnd.Offset {
+				resultEnd = ret.End
+			}
+			resultTypeElems = append(resultTypeElems, genFuncResultTypeElem(ret.Name, elemType))
+			if idx == len(syntax.Results)-1 {
+				retErrVar = ret.Name
+			}
+		}
+		blocks = append(blocks, &lib.ReplaceBlock{
+			Old: lib.Extent{
+				Start: resultStart,
+				End:   resultEnd,
+			},
+			New: resultTypeElems,
+		})
+		if wrap == WrapFunc {
 			blocks = append(blocks, &lib.ReplaceBlock{
 				Old: lib.Extent{
-					Start: resultStart,
-					End:   resultEnd,
+					Start: syntax.FirstStmt.Start,
+					End:   syntax.FirstStmt.Start,
 				},
-				New: genFuncResultType(resultTypeElems),
+				New: []ast.Node{genErrWraper(retErrVar, fmtPkg(), syntax.OuterFunc)},
 			})
+		}
 
-			for _, stmt := range syntax.Stmts {
-				var lhs []string
-				for _, v := range stmt.RetVars {
-					if v == nil {
-						lhs = append(lhs, "_")
-					} else {
-						ret, err := lib.ReadExtent(file, v)
-						if err != nil {
-							return nil, fmt.Errorf("lib.ReadExtent() failed: %w", err)
-						}
-						lhs = append(lhs, ret)
+		for _, stmt := range syntax.Stmts {
+			var lhs []ast.Expr
+			for _, v := range stmt.RetVars {
+				if v == nil {
+					lhs = append(lhs, ast.NewIdent("_"))
+				} else {
+					ret, err := src.Expr(v)
+					if err != nil {
+						return nil, fmt.Errorf("src.Expr() failed: %w", err)
 					}
+					lhs = append(lhs, ret)
 				}
-				var errVar string
-				if stmt.AssignToken == token.DEFINE.String() {
-					errVar = lib.GenVarName("err", stmt.CallExpr.Start.String())
-				} else {
-					errVar = retErrVar
+			}
+			var errVar string
+			if stmt.AssignToken == token.DEFINE.String() {
+				errVar = lib.GenVarName("err", stmt.CallExpr.Start.String())
+			} else {
+				errVar = retErrVar
+			}
+			lhs = append(lhs, ast.NewIdent(errVar))
+			callExpr, err := src.Expr(stmt.CallExpr)
+			if err != nil {
+				return nil, fmt.Errorf("src.Expr() failed: %w", err)
+			}
+			assigneStmt := genAssignStmt(lhs, lib.AssignToken(stmt.AssignToken), callExpr)
+			var errWrap ast.Expr
+			if wrap == WrapCall {
+				callee := callExpr
+				if call, ok := callExpr.(*ast.CallExpr); ok {
+					callee = call.Fun
 				}
-				lhs = append(lhs, errVar)
-				callExpr, err := lib.ReadExtent(file, stmt.CallExpr)
+				calleeStr, err := lib.FormatNode(src.Fset, callee)
 				if err != nil {
-					return nil, fmt.Errorf("lib.ReadExtent() failed: %w", err)
-				}
-				assigneStmt := genAssignStmt(lhs, stmt.AssignToken, callExpr)
-				errHandler := genErrHander(errVar, retErrVar)
-
-				if stmt.OuterStmt != nil {
-					blocks = append(blocks, &lib.ReplaceBlock{
-						Old: lib.Extent{
-							Start: stmt.OuterStmt.Start,
-							End:   stmt.OuterStmt.Start,
-						},
-						New: assigneStmt + "\n" + errHandler + "\n",
-					}, &lib.ReplaceBlock{
-						Old: *stmt.Extent,
-						New: strings.Join(lhs[:len(lhs)-1], ", "),
-					})
-				} else {
-					blocks = append(blocks, &lib.ReplaceBlock{
-						Old: *stmt.Extent,
-						New: assigneStmt + "\n" + errHandler,
-					})
+					return nil, err
 				}
+				errWrap = genCallWrap(errVar, fmtPkg(), stmt.CallExpr.Start, calleeStr)
 			}
-		}
-		for path := range addImports {
-			if path == tryFuncPkgPath {
-				delete(addImports, path)
+			errHandler := genErrHander(errVar, retErrVar, errWrap)
+
+			if stmt.OuterStmt != nil {
+				// the variables are declared ahead of the statement the call initialized
+				blocks = append(blocks, &lib.ReplaceBlock{
+					Old: lib.Extent{
+						Start: stmt.OuterStmt.Start,
+						End:   stmt.OuterStmt.Start,
+					},
+					New: []ast.Node{assigneStmt, errHandler},
+				}, &lib.ReplaceBlock{
+					Old: *stmt.Extent,
+				})
+			} else {
+				blocks = append(blocks, &lib.ReplaceBlock{
+					Old: *stmt.Extent,
+					New: []ast.Node{assigneStmt, errHandler},
+				})
 			}
 		}
-		return blocks, nil
-	})
+	}
+	for path := range addImports {
+		if path == tryFuncPkgPath {
+			delete(addImports, path)
+		}
+	}
+	return blocks, nil
+}
+
+func (t *Translator) Translation() lib.Translation {
+	return lib.NewTranslation[*lib.Extent, *TrySyntax](t)
 }
 
-func (t *Translator) Run(ctx context.Context, rootDir string, firstRun bool) error {
-	err := lib.TranslateSyntax(ctx, rootDir, firstRun, t)
+func (t *Translator) Run(ctx context.Context, cfg *lib.Config, firstRun bool) error {
+	err := lib.TranslateSyntax(ctx, cfg, firstRun, t)
 	if err != nil {
 		return fmt.Errorf("translate tryfunc syntax failed: %w", err)
 	}